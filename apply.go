@@ -0,0 +1,189 @@
+package webconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEntries sets the fields from the entries of the config file;
+// values that cannot be used are reported as diagnostics.
+func (c *Config) applyEntries(entries []entry) {
+	for i := 0; i < len(entries); i++ {
+		c.applyEntry(&entries[i])
+	}
+}
+
+func (c *Config) applyEntry(e *entry) {
+	v := e.Value
+
+	switch fmt.Sprintf("%s.%s", strings.ToLower(e.Section), e.Key) {
+	case ".maintenance-window":
+		c.MaintenanceWindowOn = c.boolValue(e)
+
+	case ".redirect-http-to-https":
+		c.RedirectHTTPtoHTTPS = c.boolValue(e)
+
+	case "site.hostname":
+		c.Site.HostName = v
+
+	case "site.alternate-hostnames":
+		c.Site.AlternateHostNames = splitList(strings.ToLower(v))
+
+	case "site.portno":
+		c.Site.PortNo = c.intValue(e)
+
+	case "site.proto":
+		c.Site.Proto = strings.ToLower(v)
+
+	case "tls.cert":
+		// cert PEM file
+		c.TLS.CertFilePath = v
+
+	case "tls.key":
+		// private key PEM file
+		c.TLS.KeyFilePath = v
+
+	case "maintenance.start":
+		c.Maintenance.Start = c.timeValue(e)
+
+	case "maintenance.end":
+		c.Maintenance.End = c.timeValue(e)
+
+	case "maintenance.retry-after":
+		c.Maintenance.RetryAfter = c.intValue(e)
+
+	case "maintenance.bypass-ip":
+		c.Maintenance.BypassIP = splitList(v)
+		c.Maintenance.bypassIP = c.ipMatcherValue(e, c.Maintenance.BypassIP)
+
+	case "maintenance.bypass-paths":
+		c.Maintenance.BypassPaths = splitList(v)
+
+	case "admin.allowed-ip-addr":
+		c.Admin.AllowedIP = splitList(v)
+		c.adminIP = c.ipMatcherValue(e, c.Admin.AllowedIP)
+
+	case "admin.run-on-startup":
+		c.Admin.RunOnStartup = c.boolValue(e)
+
+	case "admin.portno":
+		c.Admin.PortNo = uint(c.intValue(e))
+
+	case "messagebanner.display-mode":
+		c.MessageBanner.On = c.boolValue(e)
+
+	case "messagebanner.seconds-to-display":
+		c.MessageBanner.SecondsToDisplay = c.intValue(e)
+
+	case "http.allowed-methods":
+		c.HTTP.AllowedMethods = splitList(v)
+
+	case "http.trusted-proxies":
+		c.HTTP.TrustedProxies = splitList(v)
+		c.trustedProxies = c.ipMatcherValue(e, c.HTTP.TrustedProxies)
+
+	case "urlpaths.restrict-paths":
+		c.URLPaths.Restrict = splitList(v)
+
+	case "urlpaths.exclude-paths":
+		c.URLPaths.Exclude = splitList(v)
+
+	case "urlpaths.forward-paths":
+		c.URLPaths.Forward = make([]string, 0)
+		list := splitList(v)
+		for j := 0; j < len(list); j++ {
+			// The url-to must begin with /
+			p := strings.Split(list[j], "|")
+			if len(p) != 2 || !strings.HasPrefix(p[1], "/") {
+				c.diagnostics.addf(e, SeverityError, true,
+					"invalid forward-path %q; expected /url-from|/url-to (fully qualified url-forwarding is not allowed)", list[j])
+				continue
+			}
+			if !strings.HasPrefix(p[0], "/") {
+				c.diagnostics.addf(e, SeverityWarning, true,
+					"forward-path %q does not match any request; url-from must begin with /", list[j])
+			}
+			c.URLPaths.Forward = append(c.URLPaths.Forward, list[j])
+		}
+
+	case "urlpaths.conditional-http-service":
+		c.URLPaths.ServeOnlyTo = nil
+		if v == "" {
+			break
+		}
+		if err := json.Unmarshal([]byte(v), &c.URLPaths.ServeOnlyTo); err != nil {
+			c.diagnostics.addf(e, SeverityError, true, "invalid JSON: %v", err)
+			c.URLPaths.ServeOnlyTo = nil
+			break
+		}
+		for j := 0; j < len(c.URLPaths.ServeOnlyTo); j++ {
+			rule := &c.URLPaths.ServeOnlyTo[j]
+			var errs []error
+			rule.ipMatcher, errs = newCriteriaIPMatcher(rule.ServeOnlyToCriteria)
+			if rule.RuleType != CondHTTPSvc_IPAddress {
+				continue
+			}
+			// The rest are only matched against the query string.
+			for k := 0; k < len(errs); k++ {
+				c.diagnostics.addf(e, SeverityWarning, true, "rule %d (%s): %v", j+1, rule.URLPath, errs[k])
+			}
+		}
+
+	default:
+		if e.Section == dataSection {
+			if c.Data == nil {
+				c.Data = make(map[string]string)
+			}
+			if _, ok := c.Data[e.Key]; !ok {
+				c.dataKeys = append(c.dataKeys, e.Key)
+			}
+			c.Data[e.Key] = v
+		}
+	}
+}
+
+// boolValue converts on/off, yes/no and true/false.
+func (c *Config) boolValue(e *entry) bool {
+	b, ok := parseBool(e.Value)
+	if !ok {
+		c.diagnostics.addf(e, SeverityError, true, "invalid value %q; expected on/off or yes/no", e.shown())
+	}
+
+	return b
+}
+
+// intValue converts a number; blank is zero.
+func (c *Config) intValue(e *entry) int {
+	if e.Value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(e.Value)
+	if err != nil {
+		c.diagnostics.addf(e, SeverityError, true, "invalid number %q", e.shown())
+		return 0
+	}
+
+	return n
+}
+
+// timeValue converts the start/end times; blank is zero.
+func (c *Config) timeValue(e *entry) time.Time {
+	t, err := parseMaintTime(e.Value)
+	if err != nil {
+		c.diagnostics.addf(e, SeverityError, true, "%v; expected 2006-01-02 15:04 or RFC 3339", err)
+	}
+	return t
+}
+
+// ipMatcherValue creates the IPMatcher of a list; the entries
+// that are not valid are reported.
+func (c *Config) ipMatcherValue(e *entry, list []string) *IPMatcher {
+	m, errs := NewIPMatcher(list)
+	for i := 0; i < len(errs); i++ {
+		c.diagnostics.addf(e, SeverityWarning, true, "%v", errs[i])
+	}
+	return m
+}
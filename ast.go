@@ -0,0 +1,440 @@
+package webconfig
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type nodeKind int
+
+const (
+	nodeBlank nodeKind = iota
+	nodeComment
+	nodeKey
+	nodeSection
+)
+
+// astNode is a line (or continued lines) of the config file. A
+// section holds the nodes that follow its header, up to the next
+// section or top-level key; the comments and blank lines at the end
+// of a section are placed after it, as they usually belong to what
+// comes next.
+type astNode struct {
+	token
+	kind nodeKind
+
+	// section is the (built-in) name of the section that a key is
+	// in; blank for the top-level keys and the keys that could not
+	// be placed (skip is set for those).
+	section string
+	skip    bool
+
+	children []*astNode
+}
+
+// astFile is the syntax tree of a config file; the nodes are in
+// the order of the file.
+type astFile struct {
+	name  string
+	nodes []*astNode
+	diags diagList
+}
+
+// parseAST reads the free-style config format.
+//
+// A line with one word is a section header if the word is the name
+// of a section (case-insensitive); or if it's not indented and not a
+// known key, in which case it's a custom section. A key without a
+// section is placed in the only section that has it (i.e. hostname
+// goes to Site). Keys are case-insensitive, except in Data. A
+// backslash at the end of a line continues the value on the next line.
+func parseAST(name string, data []byte) *astFile {
+	f := &astFile{name: name}
+
+	var sec *astNode
+	closeSection := func() {
+		if sec == nil {
+			return
+		}
+		// move the trailing comments and blank lines out.
+		i := len(sec.children)
+		for i > 0 && sec.children[i-1].kind != nodeKey {
+			i--
+		}
+		f.nodes = append(f.nodes, sec.children[i:]...)
+		sec.children = sec.children[:i]
+		sec = nil
+	}
+
+	toks := lex(data)
+	for i := 0; i < len(toks); i++ {
+		n := &astNode{token: toks[i]}
+
+		switch n.token.kind {
+		case tokBlank:
+			n.kind = nodeBlank
+		case tokComment:
+			n.kind = nodeComment
+		default:
+			n.kind = nodeKey
+			lkey := strings.ToLower(n.key)
+
+			// A word alone; a blank value written as "" is a key.
+			if n.value == "" && n.sep == "" {
+				if def, ok := sectionDefs[lkey]; ok {
+					closeSection()
+					n.kind = nodeSection
+					n.section = def.Name
+					sec = n
+					f.nodes = append(f.nodes, n)
+					continue
+				}
+				if n.indent == "" && !isTopLevelKey(lkey) && len(sectionsOfKey(lkey)) == 0 {
+					closeSection()
+					n.kind = nodeSection
+					n.section = n.key
+					sec = n
+					f.nodes = append(f.nodes, n)
+					f.diags.addf(f.entry(n), SeverityWarning, false, "unknown section %q", n.key)
+					continue
+				}
+			}
+			if n.indent == "" && isTopLevelKey(lkey) {
+				closeSection()
+			}
+			f.placeKey(n, sec)
+			if n.err != "" && !n.skip {
+				f.diags.addf(f.entry(n), SeverityError, true, "%s", n.err)
+			}
+			if n.warn != "" && !n.skip {
+				f.diags.addf(f.entry(n), SeverityWarning, true, "%s", n.warn)
+			}
+		}
+
+		if sec != nil {
+			sec.children = append(sec.children, n)
+		} else {
+			f.nodes = append(f.nodes, n)
+		}
+	}
+	closeSection()
+
+	return f
+}
+
+// placeKey sets the section of the key node n; sec is the section
+// that n is in, if any.
+func (f *astFile) placeKey(n *astNode, sec *astNode) {
+	lkey := strings.ToLower(n.key)
+
+	switch {
+	case sec != nil && sec.section == dataSection:
+		n.section = dataSection
+
+	case isTopLevelKey(lkey):
+		n.section = ""
+
+	case sec == nil:
+		secs := sectionsOfKey(lkey)
+		if len(secs) != 1 {
+			msg := "unknown key"
+			if len(secs) > 1 {
+				msg = fmt.Sprintf("key is in more than one section (%s); place it under one", strings.Join(secs, ", "))
+			}
+			n.skip = true
+			f.diags.addf(f.entry(n), SeverityWarning, false, "%s", msg)
+			return
+		}
+		n.section = secs[0]
+
+	default:
+		n.section = sec.section
+		if def, ok := sectionDefs[strings.ToLower(sec.section)]; ok && !def.hasKey(lkey) {
+			n.skip = true
+			f.diags.addf(f.entry(n), SeverityWarning, false, "unknown key")
+		}
+	}
+}
+
+// entry returns the key/value of a key node; the keys are
+// lower-case, except in Data.
+func (f *astFile) entry(n *astNode) *entry {
+	e := &entry{
+		Section:  n.section,
+		File:     f.name,
+		Key:      strings.ToLower(n.key),
+		Value:    n.value,
+		Line:     n.line,
+		Col:      n.col,
+		ValueCol: n.valueCol,
+		Heredoc:  n.heredoc,
+	}
+	if n.kind == nodeSection {
+		e.Key = ""
+	}
+	if n.section == dataSection {
+		e.Key = n.key
+	}
+	return e
+}
+
+// walk calls fn for the nodes in the order of the file; sec is the
+// section that n is in (nil at the top).
+func (f *astFile) walk(fn func(n *astNode, sec *astNode)) {
+	for i := 0; i < len(f.nodes); i++ {
+		fn(f.nodes[i], nil)
+		for j := 0; j < len(f.nodes[i].children); j++ {
+			fn(f.nodes[i].children[j], f.nodes[i])
+		}
+	}
+}
+
+// entries returns the key/values that were placed in a section
+// (or are top-level keys); duplicates are reported.
+func (f *astFile) entries() []entry {
+	var list []entry
+	seen := make(map[string]int)
+
+	f.walk(func(n *astNode, _ *astNode) {
+		if n.kind != nodeKey || n.skip {
+			return
+		}
+		e := f.entry(n)
+
+		name := fmt.Sprintf("%s.%s", strings.ToLower(e.Section), e.Key)
+		if prev, ok := seen[name]; ok && name != "."+includeDirective {
+			f.diags.addf(e, SeverityWarning, false, "duplicate key; it overrides line %d", prev)
+		}
+		seen[name] = e.Line
+
+		list = append(list, *e)
+	})
+
+	return list
+}
+
+// findKey returns the (last) node of key in section; section is
+// blank for the keys that are not under a section header (i.e. the
+// top-level keys). The names are case-insensitive, except for the
+// keys in Data.
+func (f *astFile) findKey(section string, key string) *astNode {
+	var found *astNode
+	f.walk(func(n *astNode, sec *astNode) {
+		if n.kind != nodeKey {
+			return
+		}
+		if !strings.EqualFold(n.section, section) && (section != "" || sec != nil) {
+			return
+		}
+		if n.key == key || (n.section != dataSection && strings.EqualFold(n.key, key)) {
+			found = n
+		}
+	})
+	return found
+}
+
+// setValue replaces the value of a key node; the indentation and
+// the white space after the key are kept. A value that continued on
+// more than one line is written on one line; one with line breaks is
+// written as a heredoc (see formatValue).
+func (n *astNode) setValue(v string) {
+	sep := n.sep
+	if sep == "" && v != "" {
+		sep = " "
+	}
+	n.value = v
+	n.err = ""
+	n.warn = ""
+	n.sep = sep
+	n.valueCol = len(n.indent) + len(n.key) + len(sep) + 1
+	fv := formatValue(v, n.indent, n.eol)
+	n.heredoc = strings.HasPrefix(fv, "<<")
+	n.raw = n.indent + n.key + sep + fv + n.eol
+}
+
+// bytes returns the content of the config file.
+func (f *astFile) bytes() []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(f.nodes); i++ {
+		b.WriteString(f.nodes[i].raw)
+		for j := 0; j < len(f.nodes[i].children); j++ {
+			b.WriteString(f.nodes[i].children[j].raw)
+		}
+	}
+	return b.Bytes()
+}
+
+// findSection returns the node of the section header; name is
+// case-insensitive.
+func (f *astFile) findSection(name string) *astNode {
+	for i := 0; i < len(f.nodes); i++ {
+		if f.nodes[i].kind == nodeSection && strings.EqualFold(f.nodes[i].section, name) {
+			return f.nodes[i]
+		}
+	}
+	return nil
+}
+
+// eol returns the line ending that is used in the file.
+func (f *astFile) eol() string {
+	eol := "\n"
+	f.walk(func(n *astNode, _ *astNode) {
+		if n.eol == "\r\n" {
+			eol = n.eol
+		}
+	})
+	return eol
+}
+
+// last returns the node that is written last; nil if the file
+// is empty.
+func (f *astFile) last() *astNode {
+	if len(f.nodes) == 0 {
+		return nil
+	}
+	return f.lastOf(f.nodes[len(f.nodes)-1])
+}
+
+// endLine adds a line ending to n, if it's the last line of the
+// file and does not have one; so that a line can follow it.
+func (f *astFile) endLine(n *astNode) {
+	if n != nil && n.eol == "" {
+		n.eol = f.eol()
+		n.raw += n.eol
+	}
+}
+
+// newKey creates a key node; the indentation is of like (the key
+// before it) and the value is aligned with its value. If there is no
+// such key, indent is used.
+func (f *astFile) newKey(section string, key string, value string, like *astNode, indent string) *astNode {
+	n := &astNode{kind: nodeKey, section: section}
+	n.token = token{kind: tokKey, key: key, indent: indent, sep: " ", eol: f.eol()}
+	if like != nil {
+		n.indent = like.indent
+		if strings.Contains(like.sep, "\t") {
+			n.sep = like.sep
+		} else if w := like.valueCol - len(like.indent) - len(key) - 1; w > 1 && like.value != "" {
+			n.sep = strings.Repeat(" ", w)
+		}
+	}
+	n.setValue(value)
+
+	return n
+}
+
+// addKey adds key to the section after the keys that are there;
+// the keys without a section are added above the first section.
+func (f *astFile) addKey(section string, key string, value string) *astNode {
+	if section == "" {
+		// The comments right before the first section usually are
+		// about it.
+		i := 0
+		for i < len(f.nodes) && f.nodes[i].kind != nodeSection {
+			i++
+		}
+		if i < len(f.nodes) {
+			for i > 0 && f.nodes[i-1].kind != nodeKey {
+				i--
+			}
+		} else {
+			f.endLine(f.last())
+		}
+
+		var like *astNode
+		if i > 0 && f.nodes[i-1].kind == nodeKey {
+			like = f.nodes[i-1]
+		}
+		n := f.newKey(resolveSection(key), key, value, like, "")
+
+		f.nodes = append(f.nodes[:i], append([]*astNode{n}, f.nodes[i:]...)...)
+		return n
+	}
+
+	sec := f.findSection(section)
+
+	var like *astNode
+	if len(sec.children) > 0 {
+		like = sec.children[len(sec.children)-1]
+	}
+	f.endLine(f.lastOf(sec))
+
+	n := f.newKey(sec.section, key, value, like, "   ")
+	sec.children = append(sec.children, n)
+
+	return n
+}
+
+// lastOf returns the last node of a section.
+func (f *astFile) lastOf(sec *astNode) *astNode {
+	if len(sec.children) > 0 {
+		return sec.children[len(sec.children)-1]
+	}
+	return sec
+}
+
+// removeKey removes the nodes of key in section; it returns false
+// if there were none.
+func (f *astFile) removeKey(section string, key string) bool {
+	removed := false
+	for {
+		n := f.findKey(section, key)
+		if n == nil {
+			return removed
+		}
+		removed = true
+		f.nodes = removeNode(f.nodes, n)
+		for i := 0; i < len(f.nodes); i++ {
+			f.nodes[i].children = removeNode(f.nodes[i].children, n)
+		}
+	}
+}
+
+// addSection adds the header of a section at the end of the file;
+// after a blank line.
+func (f *astFile) addSection(name string) *astNode {
+	last := f.last()
+	f.endLine(last)
+	eol := f.eol()
+
+	if last != nil && last.kind != nodeBlank {
+		b := &astNode{kind: nodeBlank}
+		b.token = token{kind: tokBlank, raw: eol, eol: eol}
+		f.nodes = append(f.nodes, b)
+	}
+
+	n := &astNode{kind: nodeSection, section: name}
+	n.token = token{kind: tokKey, key: name, raw: name + eol, eol: eol}
+	f.nodes = append(f.nodes, n)
+
+	return n
+}
+
+// removeSection removes the header and the keys of a section.
+func (f *astFile) removeSection(sec *astNode) {
+	f.nodes = removeNode(f.nodes, sec)
+}
+
+func removeNode(list []*astNode, n *astNode) []*astNode {
+	for i := 0; i < len(list); i++ {
+		if list[i] == n {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// resolveSection returns the section that a key without a section
+// header is placed in; blank if it's a top-level key or there is
+// no (or more than one) such section.
+func resolveSection(key string) string {
+	lkey := strings.ToLower(key)
+	if isTopLevelKey(lkey) {
+		return ""
+	}
+	if secs := sectionsOfKey(lkey); len(secs) == 1 {
+		return secs[0]
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+package webconfig
+
+import (
+	"testing"
+)
+
+var astRoundTripTests = []string{
+	"",
+	"\n",
+	cfgTemplateAll,
+	"Site\n   hostname localhost\n   portno 8085",
+	"Site\r\n\tportno\t8085\r\n# comment\r\n\r\nData\r\n   k v\r\n",
+	"  # indented comment\nmaintenance-window   on   \n",
+	"URLPaths\n   forward-paths /a|/b, \\\n      /c|/d\n",
+	"Data\n   k1 a  b  c\n   k2\n   k1 again\n",
+	"Sitex\n   x y\nhostname orphan\n",
+}
+
+func TestASTRoundTrip(t *testing.T) {
+	for _, in := range astRoundTripTests {
+		if out := string(parseAST("test", []byte(in)).bytes()); out != in {
+			t.Errorf("round-trip of %q: got %q", in, out)
+		}
+	}
+}
+
+func TestASTEntries(t *testing.T) {
+	tests := []struct {
+		in      string
+		section string
+		key     string
+		value   string
+		line    int
+	}{
+		{"Site\n   portno 8085\n", "Site", "portno", "8085", 2},
+		{"site\n\tPortNo\t\t8085\n", "Site", "portno", "8085", 2},
+		{"hostname localhost\n", "Site", "hostname", "localhost", 1},
+		{"maintenance-window on\n", "", "maintenance-window", "on", 1},
+		{"URLPaths\n   forward-paths /a|/b, \\\n      /c|/d\n", "URLPaths", "forward-paths", "/a|/b, /c|/d", 2},
+		{"Data\n   MyKey  a  b \n", "Data", "MyKey", "a  b", 2},
+		{"# Site\nTLS\n   cert /x.pem\n", "TLS", "cert", "/x.pem", 3},
+	}
+	for _, tt := range tests {
+		entries := parseAST("test", []byte(tt.in)).entries()
+		if len(entries) != 1 {
+			t.Errorf("%q: got %d entries; want 1", tt.in, len(entries))
+			continue
+		}
+		e := entries[0]
+		if e.Section != tt.section || e.Key != tt.key || e.Value != tt.value || e.Line != tt.line {
+			t.Errorf("%q: got %s.%s=%q on line %d; want %s.%s=%q on line %d",
+				tt.in, e.Section, e.Key, e.Value, e.Line, tt.section, tt.key, tt.value, tt.line)
+		}
+	}
+}
+
+func FuzzASTRoundTrip(f *testing.F) {
+	for _, in := range astRoundTripTests {
+		f.Add(in)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		a := parseAST("fuzz", []byte(in))
+		if out := string(a.bytes()); out != in {
+			t.Fatalf("round-trip of %q: got %q", in, out)
+		}
+		a.entries()
+	})
+}
@@ -0,0 +1,383 @@
+package webconfig
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// bindTag is the struct tag that names the key of a field; see
+// Config.Bind.
+const bindTag = "webcfg"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// binding is a struct bound to a section; defaults is a copy of the
+// struct as it was when bound, the values of the keys that are not
+// in the config file are taken from it.
+type binding struct {
+	section  string
+	target   reflect.Value
+	defaults reflect.Value
+	fields   map[string][]int
+}
+
+// Bind sets the fields of the struct that v points to from the keys
+// of a custom section of the config file, and again on every reload;
+// i.e.
+//
+//	type Uploads struct {
+//		MaxSize  int64         `webcfg:"max-upload-size"` // 10MB
+//		Timeout  time.Duration `webcfg:"timeout"`         // 30s
+//		Scan     bool          `webcfg:"scan"`            // yes/no
+//		Types    []string      `webcfg:"types"`           // jpg, png
+//		Storage  struct {
+//			Path string `webcfg:"path"`
+//		} `webcfg:"storage"` // storage.path
+//	}
+//
+//	err := Config.Bind("Uploads", &uploads)
+//
+// A field without a tag is bound to its name in lower-case with -
+// between the words (MaxSize is max-size); the tag "-" leaves it out.
+// The fields of a nested struct are the keys prefixed with the name
+// of the struct and a dot. Bools take on/off, yes/no, true/false and
+// 1/0; durations take 30s, 5m, ... or a number of seconds; integers
+// can have a size unit (KB, MB, GB, TB; or KiB, ... also powers of
+// 1024); lists are comma-separated. A blank value is the zero value
+// of the field.
+//
+// The keys that are not in the section keep the value that the
+// field had when it was bound. A value that cannot be converted is an
+// error of the config (see Diagnostics), so the reload is rejected
+// according to the InvalidConfigPolicy; Bind returns it as a
+// *ValidationError.
+//
+// The fields are written while the config is reloaded; to read them
+// from other goroutines, hold RLockBindings or use OnChange (which is
+// called after the fields are set).
+func (c *Config) Bind(section string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("webconfig: Bind needs a pointer to a struct; not %T", v)
+	}
+	if section == "" {
+		return errors.New("webconfig: Bind needs the name of a section")
+	}
+	if _, ok := sectionDefs[strings.ToLower(section)]; ok {
+		return fmt.Errorf("webconfig: %s is a built-in section", section)
+	}
+
+	b := &binding{section: section, target: rv.Elem(), fields: make(map[string][]int)}
+	if err := b.addFields(rv.Elem().Type(), "", nil); err != nil {
+		return err
+	}
+	b.defaults = reflect.New(rv.Elem().Type()).Elem()
+	b.defaults.Set(rv.Elem())
+
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	rt.bindings = append(rt.bindings, b)
+
+	// Reload, so the section is decoded as on every reload.
+	err := c.load()
+	if _, ok := c.snapshot().bound[b]; ok && err == nil {
+		return nil
+	}
+
+	// The config was not applied; i.e. it has errors. Set the values
+	// of the config in effect.
+	var diags diagList
+	val := b.decode(c.snapshot().entries, &diags)
+
+	rt.bindMu.Lock()
+	b.target.Set(val)
+	rt.bindMu.Unlock()
+
+	if HasErrors(diags) {
+		return &ValidationError{Diagnostics: diags}
+	}
+	return nil
+}
+
+// RLockBindings locks the structs of Bind for reading; they are not
+// set until unlock is called.
+func (c *Config) RLockBindings() (unlock func()) {
+	rt := c.root().state()
+	rt.bindMu.RLock()
+	return rt.bindMu.RUnlock
+}
+
+// addFields adds the keys of the fields of t; prefix is the key of
+// the struct and index its index, if it is nested.
+func (b *binding) addFields(t reflect.Type, prefix string, index []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, tagged := f.Tag.Lookup(bindTag)
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = keyName(f.Name)
+		}
+		name = strings.ToLower(name)
+		idx := append(append([]int(nil), index...), i)
+
+		if f.Type.Kind() == reflect.Struct {
+			// The fields of an embedded struct are the struct's own.
+			p := prefix + name + "."
+			if f.Anonymous && !tagged {
+				p = prefix
+			}
+			if err := b.addFields(f.Type, p, idx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isBindable(f.Type) {
+			return fmt.Errorf("webconfig: field %s: %s cannot be bound", f.Name, f.Type)
+		}
+		b.fields[prefix+name] = idx
+	}
+	return nil
+}
+
+// decode returns a new value of the struct from the entries of the
+// section; the problems are added to diags.
+func (b *binding) decode(entries []entry, diags *diagList) reflect.Value {
+	v := reflect.New(b.defaults.Type()).Elem()
+	v.Set(b.defaults)
+
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		if !strings.EqualFold(e.Section, b.section) {
+			continue
+		}
+		idx, ok := b.fields[e.Key]
+		if !ok {
+			diags.addf(e, SeverityWarning, false, "unknown key")
+			continue
+		}
+		if err := setField(v.FieldByIndex(idx), e.Value); err != nil {
+			diags.addf(e, SeverityError, true, "%v", err)
+		}
+	}
+
+	return v
+}
+
+// decodeBindings decodes the sections of the structs of Bind; the
+// values are set when the snapshot is applied (see setBindings). The
+// caller must hold rt.mu.
+func (c *Config) decodeBindings(entries []entry) {
+	root := c.root()
+	if root.rt == nil || len(root.rt.bindings) == 0 {
+		return
+	}
+	bindings := root.rt.bindings
+
+	c.bound = make(map[*binding]reflect.Value, len(bindings))
+	for i := 0; i < len(bindings); i++ {
+		c.bound[bindings[i]] = bindings[i].decode(entries, &c.diagnostics)
+	}
+
+	// A bound section is not unknown.
+	list := c.diagnostics[:0]
+	for i := 0; i < len(c.diagnostics); i++ {
+		d := c.diagnostics[i]
+		if d.Key == "" && d.Severity == SeverityWarning && isBoundSection(bindings, d.Section) {
+			continue
+		}
+		list = append(list, d)
+	}
+	c.diagnostics = list
+}
+
+// setBindings sets the structs of Bind to the values of s; the
+// caller must hold rt.mu.
+func (c *Config) setBindings(s *Config) {
+	if len(s.bound) == 0 {
+		return
+	}
+	c.rt.bindMu.Lock()
+	defer c.rt.bindMu.Unlock()
+
+	for b, v := range s.bound {
+		b.target.Set(v)
+	}
+}
+
+func isBoundSection(bindings []*binding, section string) bool {
+	for i := 0; i < len(bindings); i++ {
+		if strings.EqualFold(bindings[i].section, section) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBindable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && isBindable(t.Elem())
+	}
+	return false
+}
+
+// setField converts s to the type of the field v; blank is the zero
+// value.
+func setField(v reflect.Value, s string) error {
+	if s == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Type() == durationType {
+		d, err := parseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, ok := parseBool(s)
+		if !ok {
+			return fmt.Errorf("invalid value %q; expected on/off or yes/no", s)
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseSize(s)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%s is out of range", s)
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := parseSize(s)
+		if err != nil {
+			return err
+		}
+		if n < 0 || v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%s is out of range", s)
+		}
+		v.SetUint(uint64(n))
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		list := splitList(s)
+		sv := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i := 0; i < len(list); i++ {
+			if err := setField(sv.Index(i), list[i]); err != nil {
+				return err
+			}
+		}
+		v.Set(sv)
+	}
+
+	return nil
+}
+
+// parseBool converts on/off, yes/no, true/false and 1/0; blank is
+// false. ok is false if s is not one of them.
+func parseBool(s string) (value bool, ok bool) {
+	switch strings.ToLower(s) {
+	case "on", "yes", "true", "1":
+		return true, true
+	case "off", "no", "false", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// parseDuration converts a duration (i.e. 1m30s) or a number of
+// seconds.
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q; i.e. 30s, 5m or 1h30m", s)
+	}
+	return d, nil
+}
+
+// sizeUnits are the units of parseSize; KB and KiB are both 1024.
+var sizeUnits = map[string]int64{
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// parseSize converts a number with an optional size unit; i.e.
+// 512, 64KB, 10 MB.
+func parseSize(s string) (int64, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+
+	i := len(s)
+	for i > 0 && unicode.IsLetter(rune(s[i-1])) {
+		i--
+	}
+	unit, ok := sizeUnits[strings.ToLower(s[i:])]
+	n, err := strconv.ParseInt(strings.TrimSpace(s[:i]), 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	if n > math.MaxInt64/unit || n < math.MinInt64/unit {
+		return 0, fmt.Errorf("%s is out of range", s)
+	}
+	return n * unit, nil
+}
+
+// keyName returns the key of a field name; i.e. max-upload-size for
+// MaxUploadSize and db-host for DBHost.
+func keyName(name string) string {
+	r := []rune(name)
+	var sb strings.Builder
+	for i := 0; i < len(r); i++ {
+		if i > 0 && unicode.IsUpper(r[i]) &&
+			(unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			sb.WriteByte('-')
+		}
+		sb.WriteRune(unicode.ToLower(r[i]))
+	}
+	return sb.String()
+}
@@ -0,0 +1,266 @@
+package webconfig
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bindBase = "Site\n   portno 80\n   proto http\nHTTP\n   allowed-methods GET\n"
+
+func TestKeyName(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"MaxUploadSize", "max-upload-size"},
+		{"DBHost", "db-host"},
+		{"HTTPServerURL", "http-server-url"},
+		{"Timeout", "timeout"},
+		{"ID", "id"},
+		{"Port2", "port2"},
+	}
+	for _, tt := range tests {
+		if got := keyName(tt.name); got != tt.key {
+			t.Errorf("keyName(%q) = %q; want %q", tt.name, got, tt.key)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s   string
+		n   int64
+		err string
+	}{
+		{"512", 512, ""},
+		{"-1", -1, ""},
+		{"64KB", 64 << 10, ""},
+		{"64kib", 64 << 10, ""},
+		{"10 MB", 10 << 20, ""},
+		{"1GiB", 1 << 30, ""},
+		{"2t", 2 << 40, ""},
+		{"100b", 100, ""},
+		{"8388607TB", 8388607 << 40, ""},
+		{"8388608TB", 0, "out of range"},
+		{"12XB", 0, "invalid number"},
+		{"MB", 0, "invalid number"},
+		{"1.5MB", 0, "invalid number"},
+	}
+	for _, tt := range tests {
+		n, err := parseSize(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseSize(%q): got %v; want %q", tt.s, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || n != tt.n {
+			t.Errorf("parseSize(%q) = %d, %v; want %d", tt.s, n, err, tt.n)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s  string
+		d  time.Duration
+		ok bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"0", 0, true},
+		{"1m30s", 90 * time.Second, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"30 s", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		d, err := parseDuration(tt.s)
+		if (err == nil) != tt.ok || d != tt.d {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v", tt.s, d, err, tt.d)
+		}
+	}
+}
+
+func TestSetField(t *testing.T) {
+	var v struct {
+		I8   int8
+		U16  uint16
+		U    uint
+		B    bool
+		F    float64
+		List []int
+	}
+	tests := []struct {
+		field string
+		s     string
+		err   string
+	}{
+		{"I8", "127", ""},
+		{"I8", "128", "out of range"},
+		{"I8", "1KB", "out of range"},
+		{"U16", "64KiB", "out of range"},
+		{"U16", "63KB", ""},
+		{"U", "-1", "out of range"},
+		{"B", "1", ""},
+		{"B", "maybe", "expected on/off"},
+		{"F", "1.5", ""},
+		{"F", "1,5", "invalid number"},
+		{"List", "1, 2KB, 3", ""},
+		{"List", "1, x", "invalid number"},
+	}
+	for _, tt := range tests {
+		err := setField(reflect.ValueOf(&v).Elem().FieldByName(tt.field), tt.s)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s %q: got %v; want %q", tt.field, tt.s, err, tt.err)
+		}
+	}
+	if v.U16 != 63<<10 || !v.B || v.F != 1.5 || len(v.List) != 3 || v.List[1] != 2<<10 {
+		t.Errorf("got %+v", v)
+	}
+
+	// Blank is the zero value.
+	if err := setField(reflect.ValueOf(&v).Elem().FieldByName("B"), ""); err != nil || v.B {
+		t.Errorf("blank bool: got %v, %v; want false", v.B, err)
+	}
+	if err := setField(reflect.ValueOf(&v).Elem().FieldByName("List"), ""); err != nil || v.List != nil {
+		t.Errorf("blank list: got %v, %v; want nil", v.List, err)
+	}
+}
+
+type bindStorage struct {
+	Path string `webcfg:"path"`
+}
+
+type BindCommon struct {
+	Region string
+}
+
+type bindUploads struct {
+	BindCommon
+	MaxSize  int64         `webcfg:"max-upload-size"`
+	Timeout  time.Duration `webcfg:"timeout"`
+	Scan     bool          `webcfg:"scan"`
+	Types    []string      `webcfg:"types"`
+	DBHost   string
+	Internal string      `webcfg:"-"`
+	Storage  bindStorage `webcfg:"storage"`
+	Backup   struct {
+		Path string
+	}
+}
+
+func TestBind(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	readTestConfig(t, c, bindBase+`Uploads
+   max-upload-size 10MB
+   timeout         30
+   scan            yes
+   types           jpg, png
+   db-host         db1
+   region          eu
+   storage.path    /var/up
+   backup.path     /var/bak
+   internal        x
+`)
+
+	u := bindUploads{Timeout: time.Minute, Internal: "keep"}
+	if err := c.Bind("Uploads", &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.MaxSize != 10<<20 || u.Timeout != 30*time.Second || !u.Scan || strings.Join(u.Types, ",") != "jpg,png" ||
+		u.DBHost != "db1" || u.Region != "eu" || u.Storage.Path != "/var/up" || u.Backup.Path != "/var/bak" {
+		t.Errorf("got %+v", u)
+	}
+	if u.Internal != "keep" {
+		t.Errorf("got internal %q; the field with the tag - must be left out", u.Internal)
+	}
+	warnings := 0
+	for _, d := range c.Diagnostics() {
+		if d.Section == "Uploads" && d.Key == "internal" && d.Severity == SeverityWarning {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("got %d warnings for internal; want 1 (unknown key)", warnings)
+	}
+
+	// The fields are set again on reload; the keys that were removed
+	// get the value the field had when it was bound.
+	readTestConfig(t, c, bindBase+"Uploads\n   timeout 1m30s\n   scan off\n")
+	unlock := c.RLockBindings()
+	got := u
+	unlock()
+	if got.Timeout != 90*time.Second || got.Scan || got.MaxSize != 0 || got.Types != nil || got.DBHost != "" {
+		t.Errorf("after reload: got %+v", got)
+	}
+	if got.Internal != "keep" {
+		t.Errorf("after reload: got internal %q; want keep", got.Internal)
+	}
+
+	readTestConfig(t, c, bindBase)
+	if u.Timeout != time.Minute {
+		t.Errorf("got timeout %v; want the default 1m", u.Timeout)
+	}
+}
+
+func TestBindArgs(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+
+	var u bindUploads
+	if err := c.Bind("Uploads", u); err == nil {
+		t.Error("a struct that is not a pointer was bound")
+	}
+	if err := c.Bind("", &u); err == nil {
+		t.Error("a blank section was bound")
+	}
+	if err := c.Bind("site", &u); err == nil {
+		t.Error("a built-in section was bound")
+	}
+	var bad struct {
+		M map[string]string
+	}
+	if err := c.Bind("Uploads", &bad); err == nil || !strings.Contains(err.Error(), "cannot be bound") {
+		t.Errorf("got %v; want cannot be bound", err)
+	}
+}
+
+// TestBindErrors binds a section when the config is not applied; the
+// fields are set from the config in effect.
+func TestBindErrors(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	readTestConfig(t, c, bindBase+"Uploads\n   timeout 30s\n   max-upload-size lots\n")
+
+	// The value of max-upload-size is an error; the config is not
+	// applied, the other fields are set and the default is kept.
+	u := bindUploads{MaxSize: 1 << 20}
+	err := c.Bind("Uploads", &u)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v; want a *ValidationError", err)
+	}
+	if len(verr.Diagnostics) != 1 || verr.Diagnostics[0].Key != "max-upload-size" {
+		t.Errorf("got %v; want the error of max-upload-size", verr.Diagnostics)
+	}
+	if u.Timeout != 30*time.Second || u.MaxSize != 1<<20 {
+		t.Errorf("got timeout %v, max-upload-size %d; want 30s, 1048576", u.Timeout, u.MaxSize)
+	}
+
+	// The file on disk has a new error; it's not applied, so the
+	// fields of another struct are set from the config in effect.
+	if err := os.WriteFile(c.ConfigFilePath, []byte("Site\n   portno 0\nUploads\n   timeout 45s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var w struct {
+		Timeout time.Duration `webcfg:"timeout"`
+	}
+	if err := c.Bind("uploads", &w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Timeout != 30*time.Second {
+		t.Errorf("got timeout %v; want 30s of the config in effect", w.Timeout)
+	}
+}
@@ -0,0 +1,129 @@
+package webconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DataSection reads the values of the Data section with conversions;
+// the values are of one snapshot (see Snapshot), so they're consistent
+// with each other. The getters return def if the key is not set, and
+// an error (with def) if the value cannot be converted.
+type DataSection struct {
+	s *Config
+}
+
+// DataSection returns the Data section of the current snapshot; the
+// values are in plain text, as in DataValue. i.e.
+//
+//	data := Config.DataSection()
+//	timeout, err := data.GetDuration("request-timeout", 30*time.Second)
+func (c *Config) DataSection() DataSection {
+	return DataSection{s: c.snapshot()}
+}
+
+// Has tells if key is in the Data section.
+func (d DataSection) Has(key string) bool {
+	_, ok := d.s.Data[key]
+	return ok
+}
+
+// Keys returns the keys in the order of the config file; the keys
+// of the environment variables (see EnvVarName) are last.
+func (d DataSection) Keys() []string {
+	return append([]string(nil), d.s.dataKeys...)
+}
+
+// Range calls fn for each key and value in the order of Keys; it
+// stops when fn returns false.
+func (d DataSection) Range(fn func(key string, value string) bool) {
+	for i := 0; i < len(d.s.dataKeys); i++ {
+		if !fn(d.s.dataKeys[i], d.s.Data[d.s.dataKeys[i]]) {
+			return
+		}
+	}
+}
+
+// GetString returns the value of key as written.
+func (d DataSection) GetString(key string, def string) string {
+	if v, ok := d.s.Data[key]; ok {
+		return v
+	}
+	return def
+}
+
+// GetInt returns the value of key as an int.
+func (d DataSection) GetInt(key string, def int) (int, error) {
+	v, ok := d.s.Data[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return def, d.errorf(key, "invalid number %q", v)
+	}
+	return n, nil
+}
+
+// GetBool returns the value of key as a bool; on/off, yes/no,
+// true/false and 1/0 (blank is false).
+func (d DataSection) GetBool(key string, def bool) (bool, error) {
+	v, ok := d.s.Data[key]
+	if !ok {
+		return def, nil
+	}
+	b, ok := parseBool(strings.TrimSpace(v))
+	if !ok {
+		return def, d.errorf(key, "invalid value %q; expected on/off or yes/no", v)
+	}
+	return b, nil
+}
+
+// GetDuration returns the value of key as a duration; i.e. 1m30s, or
+// a number of seconds.
+func (d DataSection) GetDuration(key string, def time.Duration) (time.Duration, error) {
+	v, ok := d.s.Data[key]
+	if !ok {
+		return def, nil
+	}
+	t, err := parseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return def, d.errorf(key, "%v", err)
+	}
+	return t, nil
+}
+
+// GetStringSlice returns the comma-separated value of key as a
+// list; the items are trimmed and blank ones are left out.
+func (d DataSection) GetStringSlice(key string, def []string) []string {
+	if v, ok := d.s.Data[key]; ok {
+		return splitList(v)
+	}
+	return def
+}
+
+// GetJSON decodes the JSON value of key into out; ErrKeyNotFound is
+// returned if key is not set (out is not changed).
+func (d DataSection) GetJSON(key string, out interface{}) error {
+	v, ok := d.s.Data[key]
+	if !ok {
+		return fmt.Errorf("%s.%s: %w", dataSection, key, ErrKeyNotFound)
+	}
+	if err := json.Unmarshal([]byte(v), out); err != nil {
+		return d.errorf(key, "%v", err)
+	}
+	return nil
+}
+
+// errorf returns the error of the value of key; the secret values
+// are redacted.
+func (d DataSection) errorf(key string, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if v := d.s.Data[key]; v != "" && (d.s.secrets[strings.ToLower(dataSection)+"."+key] || isSecretKey(key)) {
+		msg = strings.ReplaceAll(msg, strconv.Quote(v), redacted)
+	}
+	return fmt.Errorf("%s.%s: %s", dataSection, key, msg)
+}
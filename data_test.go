@@ -0,0 +1,147 @@
+package webconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dataTestConfig = bindBase + `Data
+   greeting      hello   big    world
+   retries       3
+   bad-int       3x
+   debug         on
+   verbose       1
+   maybe         sometimes
+   timeout       1m30s
+   wait          45
+   bad-duration  soon
+   hosts         a.example,  b.example , ,c.example
+   limits        {"max": 10, "names": ["x", "y"]}
+   bad-json      {"max":
+   db-password   hunter2
+`
+
+func newDataTestConfig(t *testing.T) DataSection {
+	t.Helper()
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	s := readTestConfig(t, c, dataTestConfig)
+	if d := s.Diagnostics(); HasErrors(d) {
+		t.Fatal(d)
+	}
+	return c.DataSection()
+}
+
+func TestDataSectionGetString(t *testing.T) {
+	d := newDataTestConfig(t)
+
+	// As written; the runs of spaces within the value are kept.
+	if got := d.GetString("greeting", ""); got != "hello   big    world" {
+		t.Errorf("got %q; want %q", got, "hello   big    world")
+	}
+	if got := d.GetString("missing", "def"); got != "def" {
+		t.Errorf("got %q; want def", got)
+	}
+	if !d.Has("retries") || d.Has("missing") {
+		t.Error("Has: wrong result")
+	}
+}
+
+func TestDataSectionGetters(t *testing.T) {
+	d := newDataTestConfig(t)
+
+	tests := []struct {
+		name string
+		get  func() (interface{}, error)
+		want interface{}
+		err  string
+	}{
+		{"int", func() (interface{}, error) { return d.GetInt("retries", 1) }, 3, ""},
+		{"int missing", func() (interface{}, error) { return d.GetInt("missing", 7) }, 7, ""},
+		{"int invalid", func() (interface{}, error) { return d.GetInt("bad-int", 7) }, 7, `Data.bad-int: invalid number "3x"`},
+		{"bool", func() (interface{}, error) { return d.GetBool("debug", false) }, true, ""},
+		{"bool 1", func() (interface{}, error) { return d.GetBool("verbose", false) }, true, ""},
+		{"bool missing", func() (interface{}, error) { return d.GetBool("missing", true) }, true, ""},
+		{"bool invalid", func() (interface{}, error) { return d.GetBool("maybe", true) }, true,
+			`Data.maybe: invalid value "sometimes"; expected on/off or yes/no`},
+		{"duration", func() (interface{}, error) { return d.GetDuration("timeout", 0) }, 90 * time.Second, ""},
+		{"duration seconds", func() (interface{}, error) { return d.GetDuration("wait", 0) }, 45 * time.Second, ""},
+		{"duration missing", func() (interface{}, error) { return d.GetDuration("missing", time.Second) }, time.Second, ""},
+		{"duration invalid", func() (interface{}, error) { return d.GetDuration("bad-duration", time.Second) }, time.Second,
+			`Data.bad-duration: invalid duration "soon"`},
+		{"secret", func() (interface{}, error) { return d.GetInt("db-password", 0) }, 0,
+			`Data.db-password: invalid number ` + redacted},
+	}
+	for _, tt := range tests {
+		got, err := tt.get()
+		if got != tt.want {
+			t.Errorf("%s: got %v; want %v", tt.name, got, tt.want)
+		}
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v; want %q", tt.name, err, tt.err)
+		}
+		if err != nil && strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("%s: the secret value is in the error: %v", tt.name, err)
+		}
+	}
+}
+
+func TestDataSectionGetStringSlice(t *testing.T) {
+	d := newDataTestConfig(t)
+
+	if got := d.GetStringSlice("hosts", nil); strings.Join(got, "|") != "a.example|b.example|c.example" {
+		t.Errorf("got %q; want [a.example b.example c.example]", got)
+	}
+	if got := d.GetStringSlice("missing", []string{"x"}); len(got) != 1 || got[0] != "x" {
+		t.Errorf("got %q; want the default [x]", got)
+	}
+}
+
+func TestDataSectionGetJSON(t *testing.T) {
+	d := newDataTestConfig(t)
+
+	var limits struct {
+		Max   int      `json:"max"`
+		Names []string `json:"names"`
+	}
+	if err := d.GetJSON("limits", &limits); err != nil {
+		t.Fatal(err)
+	}
+	if limits.Max != 10 || strings.Join(limits.Names, ",") != "x,y" {
+		t.Errorf("got %+v", limits)
+	}
+
+	if err := d.GetJSON("missing", &limits); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got %v; want ErrKeyNotFound", err)
+	}
+	if err := d.GetJSON("bad-json", &limits); err == nil || !strings.HasPrefix(err.Error(), "Data.bad-json: ") {
+		t.Errorf("got %v; want an error of Data.bad-json", err)
+	}
+	if limits.Max != 10 {
+		t.Errorf("got max %d; out must not be changed", limits.Max)
+	}
+}
+
+func TestDataSectionKeys(t *testing.T) {
+	d := newDataTestConfig(t)
+
+	want := []string{"greeting", "retries", "bad-int", "debug", "verbose", "maybe", "timeout", "wait",
+		"bad-duration", "hosts", "limits", "bad-json", "db-password"}
+	if got := d.Keys(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// Range in the same order; it stops when fn returns false.
+	var keys []string
+	d.Range(func(key string, value string) bool {
+		keys = append(keys, key)
+		if key == "retries" && value != "3" {
+			t.Errorf("got retries %q; want 3", value)
+		}
+		return key != "debug"
+	})
+	if strings.Join(keys, " ") != "greeting retries bad-int debug" {
+		t.Errorf("got %v; want the keys up to debug", keys)
+	}
+}
@@ -1,5 +1,10 @@
 package webconfig
 
+import (
+	"reflect"
+	"sync"
+)
+
 const (
 	CondHTTPSvc_Header      = "header"
 	CondHTTPSvc_IPAddress   = "ip-address"
@@ -28,6 +33,10 @@ type ConditionalHTTPService struct {
 	// HTTPStatusCode is http status code that will be retured, if
 	// a match is found. The default is 404 (not found).
 	HTTPStatusCode int `json:"http-status-code"`
+
+	// ipMatcher holds the criteria that are ip addresses, CIDR
+	// blocks or ranges; it's set when the config is read.
+	ipMatcher *IPMatcher
 }
 type messageBanner struct {
 	On               bool `json:"on"`
@@ -36,12 +45,17 @@ type messageBanner struct {
 	// When the value of On changes from false to true
 	// Tickout is set to SecondsToDisplay and then
 	// decremented every second until the banner is closed
-	// (on set to false).
+	// (on set to false). Snapshots keep the value they were
+	// loaded with; see Config.MessageBannerTimeLeft.
 	TickCount int `json:"tick-count"`
 }
 
 type httpx struct {
 	AllowedMethods []string `json:"allowed-methods"`
+
+	// TrustedProxies are the load balancers/proxies in front of the
+	// website; ip addresses, CIDR blocks or ranges. See Config.ClientIP.
+	TrustedProxies []string `json:"trusted-proxies"`
 }
 
 // tlsFiles defines the location of the certificate and
@@ -67,6 +81,8 @@ type urlPaths struct {
 // available via the localhost (i.e. on the local
 // machine or ssh tunnel) or a list of recognized
 // IP addresses.
+// AllowedIP entries can be single addresses, CIDR blocks,
+// ranges or wildcards; see IPMatcher.
 type admin struct {
 	RunOnStartup bool     `json:"run-on-sartup"`
 	PortNo       uint     `json:"port-no"`
@@ -94,8 +110,16 @@ type site struct {
 // Config is defines the fields that are typically required for
 // web configuration.  All config values have to have a
 // presentation in this struct.
+//
+// A Config is safe for concurrent use. The values read from the
+// config file are kept in snapshots that are swapped on reload; read
+// them via Snapshot (or the methods). The fields of the Config
+// returned by NewWebConfig are also updated on reload, for code that
+// reads them between reloads; reading them while a reload may happen
+// (i.e. in request handlers) is a data race. Options such as
+// ValidateRemoteHost must be set before the Config is used by request
+// handlers; they're copied to the snapshots on reload.
 type Config struct {
-	refreshRate        uint      // in seconds
 	WebRootPath        string    `json:"web-rootp-path"`
 	AppDataPath        string    `json:"appdata-path"`
 	ConnStat           siteStats `json:"conn-stat"`
@@ -114,12 +138,59 @@ type Config struct {
 
 	// These are the offender IP addr. Their connections
 	// are drop immediately, without any message returned to them.
+	// Entries can be single addresses, CIDR blocks, ranges or
+	// wildcards; see IPMatcher.
 	BlockedIP []string `json:"blocked-ip"`
 
+	// blockedIP, adminIP and trustedProxies are the parsed BlockedIP,
+	// Admin.AllowedIP and HTTP.TrustedProxies; they're set when the
+	// config is read.
+	blockedIP      *IPMatcher
+	adminIP        *IPMatcher
+	trustedProxies *IPMatcher
+
+	// blockedIPHash is the hash of the blocked-ip file and
+	// maintPageHash the one of the maintenance page.
+	blockedIPHash string
+	maintPageHash string
+
+	// includes are the included (and drop-in) files that were read,
+	// includePatterns the paths/globs that are watched for them and
+	// includeHash is the hash of their content; see readEntries.
+	includes        []string
+	includePatterns []string
+	includeHash     string
+
+	// secrets are the keys (section.key; lower-case section) whose
+	// values are redacted; see decryptSecrets.
+	secrets map[string]bool
+
+	// dataKeys are the keys of Data in the order of the file; see
+	// DataSection.Keys.
+	dataKeys []string
+
+	// bound are the values of the structs of Bind; see decodeBindings.
+	bound map[*binding]reflect.Value
+
+	// entries are the key/values read from the config file and
+	// diagnostics are the problems found in them.
+	entries     []entry
+	diagnostics diagList
+
+	// DropBlockedConnections tells ValidateHTTPRequest to hijack and
+	// close the connection of a blocked ip addr; nothing is written
+	// back to the client. Otherwise, StatusBlockedIP is returned and
+	// the caller decides what to write.
+	DropBlockedConnections bool `json:"drop-blocked-connections"`
+
 	RedirectHTTPtoHTTPS bool `json:"redirect-http-to-https"`
 
 	MaintenanceWindowOn bool `json:"maintenance-windowon"`
 
+	// Maintenance holds the schedule, Retry-After and bypass
+	// list of the maintenance window; see InMaintenance.
+	Maintenance maintenance `json:"maintenance"`
+
 	MessageBanner messageBanner `json:"messagebanner"`
 
 	//-------------------------------------------------
@@ -132,8 +203,25 @@ type Config struct {
 
 	TLS  tlsFiles          `json:"tls"`
 	Data map[string]string `json:"data"`
+
+	// errorPages are the renderers used by Middleware; see SetErrorPage.
+	errorPages   map[int]ErrorPageFunc
+	errorPagesMu sync.RWMutex
+
+	// rt is the runtime state of the Config returned by NewWebConfig;
+	// it's nil in snapshots. origin is the Config that a snapshot
+	// was taken from.
+	rt     *runtimeState
+	origin *Config
 }
 
+// blockedIPFileName is the name of the offenders file in
+// /appdata/.cfg.
+const blockedIPFileName = "blocked-ip"
+
+// maintPageFileName is the name of the maintenance page in /appdata.
+const maintPageFileName = "maint-page.html"
+
 const (
 	cfgTemplateAll string = `
 # ------------------------------------------------------------------
@@ -142,6 +230,12 @@ const (
 #   --comments must begin with #.
 #   --one key/value per line; to continue to another line, 
 #     place a backslash (\) at the end of the statement.
+#   --a value with line breaks (i.e. PEM, SQL or JSON) can be a
+#     heredoc; the lines up to EOT are kept as they are:
+#        my-key <<EOT
+#        ...
+#        EOT
+#     and a value in double quotes can have escapes (\n, \t, \").
 #   --The headers and keys are case- insensitive, but the
 #     following is the recommanded format:
 #        SomeHeaderName
@@ -178,12 +272,39 @@ TLS
 # site needs to be worked on. Your app will have to response 
 # to requests (and display a maint-page) accordingly.
 maintenance-window     off
+
+# Requests that come over http are redirected to https (on/off).
+redirect-http-to-https off
+
+# The maintenance window; requests get the 503 (Service Unavailable) status
+# with a Retry-After header and the page in /appdata/maint-page.html, 
+# while maintenance-window is on or within the start/end times below.
+Maintenance
+   # start/end open and close the window automatically; either can be blank.
+   # Format: 2006-01-02 15:04 (local time) or RFC 3339.
+   # e.g.
+   # start   2021-10-02 22:00
+   # end     2021-10-03 02:00
+   start
+   end
+
+   # seconds that clients are asked to wait, if end is not set.
+   retry-after     300
+
+   # ip addresses and url paths that are served during the window;
+   # separated by comma. A path ending with / covers all paths under it.
+   bypass-ip       127.0.0.1, ::1
+   bypass-paths    /healthz
  
 Admin
    # List of IP address that will be allowed to access 
    # the admin website; separated by comma; otherwise, the admin
    # section of the website will only be served to the local machine.
-   allowed-ip-addr	<ip add 1>, <ip add 2>
+   # CIDR blocks (10.0.0.0/8), ranges (10.0.0.1-10.0.0.9) and
+   # wildcards (10.0.*.*) are also accepted.
+   # e.g.
+   # allowed-ip-addr	10.0.0.5, 192.168.1.0/24
+   allowed-ip-addr
    run-on-startup	yes          
    portno			30000
 
@@ -242,6 +363,14 @@ URLPaths
 HTTP
    allowed-methods     GET, OPTIONS, CONNECT, HEAD
 
+   # The load balancers/proxies in front of the website; ip addresses or
+   # CIDR blocks separated by comma. When a request comes from one of them,
+   # the client ip is taken from the Forwarded, X-Forwarded-For or X-Real-IP
+   # header; otherwise these headers are ignored.
+   # e.g.
+   # trusted-proxies   10.0.0.0/8, 192.168.1.10
+   trusted-proxies
+
 # This section holds user-data. The following is the format.
 # Key...... no spaces
 # Value.... can include spaces.
@@ -252,14 +381,37 @@ HTTP
 #     my-postgresql-conn-str  User ID=root;Password=pwd;Host=localhost;Port=5432;Database=mydb;Pooling=false;
 #     my-json-value           {"mylist":["v1","v2"]}
 #     my-hex-value            68656c6c6f206f75742074686572652e206775697461722069732074686520736f6e67
+#
+# Secrets (i.e. passwords) should be encrypted; the value is then
+# enc:<base64>; see Config.EncryptValue and Config.SetSecret. The key
+# is in /appdata/.cfg/secret.key (or the WEBCONFIG_SECRET_KEY env var).
+#     my-postgresql-conn-str  enc:7Vq8c2X...
 Data
    
+`
+	cfgTemplateMaintPage string = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Down for maintenance</title>
+</head>
+<body>
+	<h1>Down for maintenance</h1>
+	<p>{{.HostName}} is undergoing maintenance; please, try again later.</p>
+	{{if not .End.IsZero}}<p>We expect to be back by {{.End.Format "Jan 2, 2006 15:04 MST"}}.</p>{{end}}
+</body>
+</html>
 `
 	cnfTemplateBlockedIP string = `
 # ip addresses in this file will be blocked from connecting the website.
 # the following is the format:
 # <ip address><minimum of one space><description>
+# The ip address can also be a CIDR block, a range or an IPv4 wildcard.
 # Example:
 # 10.12.3.4 <a short description of the reason>
+# 192.168.10.0/24 <a short description of the reason>
+# 2001:db8::/32 <a short description of the reason>
+# 172.16.0.1-172.16.0.99 <a short description of the reason>
+# 10.20.*.* <a short description of the reason>
 `
 )
@@ -0,0 +1,126 @@
+package webconfig
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Severity tells how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityWarning is for entries that were ignored or
+	// questionable; i.e. unknown keys, duplicates.
+	SeverityWarning Severity = iota
+
+	// SeverityError is for values that could not be used;
+	// i.e. a portno that is not a number.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic describes a problem found while reading the config
+// files. Line and Column are 1-based; Column points to the key or
+// the value that the message is about. Line is zero if the key is
+// not in the file.
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Section  string   `json:"section"`
+	Key      string   `json:"key"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String returns the diagnostic in the file:line:column form.
+func (d Diagnostic) String() string {
+	name := d.Key
+	if d.Section != "" && d.Key != "" {
+		name = fmt.Sprintf("%s.%s", d.Section, d.Key)
+	} else if d.Section != "" {
+		name = d.Section
+	}
+	if name != "" {
+		name = fmt.Sprintf(" [%s]", name)
+	}
+
+	if d.Line == 0 {
+		// i.e. a required key that is not in the file
+		return fmt.Sprintf("%s: %s: %s%s", d.File, d.Severity, d.Message, name)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s%s", d.File, d.Line, d.Column, d.Severity, d.Message, name)
+}
+
+// Diagnostics returns the problems found in the config files the
+// last time they were read; nil if there were none.
+func (c *Config) Diagnostics() []Diagnostic {
+	return append([]Diagnostic(nil), c.snapshot().diagnostics...)
+}
+
+// HasErrors tells if any of the diagnostics is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for i := 0; i < len(diags); i++ {
+		if diags[i].Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// diagList collects diagnostics.
+type diagList []Diagnostic
+
+// addf adds a diagnostic about e; valueCol tells whether it's about
+// the value (or the key).
+func (d *diagList) addf(e *entry, sev Severity, valueCol bool, format string, a ...interface{}) {
+	col := e.Col
+	if valueCol {
+		col = e.ValueCol
+	}
+	*d = append(*d, Diagnostic{
+		File:     e.File,
+		Line:     e.Line,
+		Column:   col,
+		Section:  e.Section,
+		Key:      e.Key,
+		Severity: sev,
+		Message:  strings.TrimSpace(fmt.Sprintf(format, a...)),
+	})
+}
+
+// sort orders the diagnostics by file and position.
+func (d diagList) sort() {
+	sort.SliceStable(d, func(i, j int) bool {
+		if d[i].File != d[j].File {
+			return d[i].File < d[j].File
+		}
+		if d[i].Line != d[j].Line {
+			return d[i].Line < d[j].Line
+		}
+		return d[i].Column < d[j].Column
+	})
+}
+
+// logDiagnostics logs the diagnostics that were not in prev (the ones
+// of the config in effect); so that a reload does not repeat what has
+// been logged.
+func (c *Config) logDiagnostics(prev diagList) {
+	seen := make(map[string]bool, len(prev))
+	for i := 0; i < len(prev); i++ {
+		seen[prev[i].String()] = true
+	}
+	for i := 0; i < len(c.diagnostics); i++ {
+		if s := c.diagnostics[i].String(); !seen[s] {
+			log.Printf("webconfig: %s", s)
+		}
+	}
+}
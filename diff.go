@@ -0,0 +1,137 @@
+package webconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around a change.
+const diffContext = 3
+
+// diffOp is a line of a diff; kind is ' ', '-' or '+'. ai and bi are
+// the (0-based) line numbers in a and b where the op is.
+type diffOp struct {
+	kind   byte
+	text   string
+	ai, bi int
+}
+
+// diffLines returns the unified diff from a to b; blank if they're
+// the same.
+func diffLines(nameA string, nameB string, a []byte, b []byte) string {
+	ops := diffOps(splitLines(string(a)), splitLines(string(b)))
+
+	var sb strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// A hunk goes on while the changes are not too far apart.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+				continue
+			}
+			if j-end > 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		na, nb := 0, 0
+		for j := start; j < stop; j++ {
+			if ops[j].kind != '+' {
+				na++
+			}
+			if ops[j].kind != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(ops[start].ai, na), hunkRange(ops[start].bi, nb))
+		for j := start; j < stop; j++ {
+			fmt.Fprintf(&sb, "%c%s\n", ops[j].kind, ops[j].text)
+		}
+
+		i = stop
+	}
+
+	return sb.String()
+}
+
+// diffOps returns the edits from a to b by the longest common
+// subsequence of the lines.
+func diffOps(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+
+	lcs := make([][]int, n+1)
+	for i := 0; i <= n; i++ {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i > -1; i-- {
+		for j := m - 1; j > -1; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	return ops
+}
+
+// hunkRange formats the start,count of a hunk; start is 0-based.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s into lines without the line endings.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	return lines
+}
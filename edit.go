@@ -0,0 +1,156 @@
+package webconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrSectionNotFound is returned when a section is not in the
+	// config file.
+	ErrSectionNotFound = errors.New("section not found")
+
+	// ErrKeyNotFound is returned when a key is not in the config file.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrSectionExists is returned by AddSection when the section is
+	// already in the config file.
+	ErrSectionExists = errors.New("section already exists")
+
+	// ErrConflict is returned by Update when the config file was
+	// changed (i.e. by another process) since it was read.
+	ErrConflict = errors.New("the config file has been changed by another writer")
+
+	// ErrNotApplied is returned (wrapped) by Update when the config
+	// file was written, but it has errors and the config in effect
+	// was kept.
+	ErrNotApplied = errors.New("the config file was written, but it was not applied")
+)
+
+// Set sets the value of key in section; the key is added (after the
+// other keys of the section) if it's not in the file. section is blank
+// for the top-level keys (i.e. maintenance-window); a key that belongs
+// to one section only (i.e. hostname) can also be set without its
+// section. The rest of the file is written as it was and the config
+// is reloaded. Set is an Update with one edit.
+func (c *Config) Set(section string, key string, value string) error {
+	return c.Update(func(tx *Tx) error {
+		return tx.Set(section, key, value)
+	})
+}
+
+// Delete removes key from section; ErrKeyNotFound is returned if
+// it's not in the file.
+func (c *Config) Delete(section string, key string) error {
+	return c.Update(func(tx *Tx) error {
+		return tx.Delete(section, key)
+	})
+}
+
+// AddSection adds the header of a section at the end of the config
+// file; ErrSectionExists is returned if it's already there. Use Set
+// to add its keys.
+func (c *Config) AddSection(name string) error {
+	return c.Update(func(tx *Tx) error {
+		return tx.AddSection(name)
+	})
+}
+
+// RemoveSection removes a section with all its keys; the comments
+// before the section header are kept.
+func (c *Config) RemoveSection(name string) error {
+	return c.Update(func(tx *Tx) error {
+		return tx.RemoveSection(name)
+	})
+}
+
+// set is Config.Set on the syntax tree.
+func (f *astFile) set(section string, key string, value string) error {
+	if err := checkKey(section, key); err != nil {
+		return err
+	}
+
+	name := section
+	if name == "" {
+		name = resolveSection(key)
+	}
+	if n := f.findKey(name, key); n != nil {
+		n.setValue(value)
+		return nil
+	}
+	if name != "" && f.findSection(name) != nil {
+		f.addKey(name, key, value)
+		return nil
+	}
+	if section != "" {
+		return fmt.Errorf("%w: %s", ErrSectionNotFound, section)
+	}
+	f.addKey("", key, value)
+
+	return nil
+}
+
+// delete is Config.Delete on the syntax tree.
+func (f *astFile) delete(section string, key string) error {
+	name := section
+	if name == "" && f.findKey("", key) == nil {
+		name = resolveSection(key)
+	}
+	if !f.removeKey(name, key) {
+		if name == "" {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return fmt.Errorf("%w: %s.%s", ErrKeyNotFound, name, key)
+	}
+	return nil
+}
+
+// removeSectionByName is Config.RemoveSection on the syntax tree.
+func (f *astFile) removeSectionByName(name string) error {
+	sec := f.findSection(name)
+	if sec == nil {
+		return fmt.Errorf("%w: %s", ErrSectionNotFound, name)
+	}
+	f.removeSection(sec)
+	return nil
+}
+
+// addSectionByName is Config.AddSection on the syntax tree.
+func (f *astFile) addSectionByName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n#") {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	if f.findSection(name) != nil {
+		return fmt.Errorf("%w: %s", ErrSectionExists, name)
+	}
+	if def, ok := sectionDefs[strings.ToLower(name)]; ok {
+		name = def.Name
+	} else if lname := strings.ToLower(name); isTopLevelKey(lname) || len(sectionsOfKey(lname)) > 0 {
+		// it would be read as a key
+		return fmt.Errorf("invalid section name %q; it's the name of a key", name)
+	}
+	f.addSection(name)
+
+	return nil
+}
+
+// checkKey tells if key can be written in section.
+func checkKey(section string, key string) error {
+	if key == "" || strings.ContainsAny(key, " \t\r\n") || strings.HasPrefix(key, "#") {
+		return fmt.Errorf("invalid key %q", key)
+	}
+
+	lkey := strings.ToLower(key)
+	if section == "" {
+		if !isTopLevelKey(lkey) && resolveSection(key) == "" {
+			return fmt.Errorf("%s needs a section", key)
+		}
+		return nil
+	}
+	if def, ok := sectionDefs[strings.ToLower(section)]; ok && !def.hasKey(lkey) {
+		return fmt.Errorf("%s is not a key of %s", key, def.Name)
+	}
+
+	return nil
+}
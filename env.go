@@ -0,0 +1,274 @@
+package webconfig
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that
+// override the config values; i.e. WEBCONFIG_SITE_PORTNO.
+const envPrefix = "WEBCONFIG_"
+
+// Origin tells where a config value comes from.
+type Origin string
+
+const (
+	// OriginFile is for the values of the config file.
+	OriginFile Origin = "file"
+
+	// OriginEnv is for the values that are overridden by an
+	// environment variable; see EnvVarName.
+	OriginEnv Origin = "env"
+)
+
+// ValueSource describes where the value of section.key comes from;
+// see Config.Source.
+type ValueSource struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+
+	// Value is the value in effect; after ${VAR} expansion. It's
+	// redacted if Secret is set.
+	Value  string `json:"value"`
+	Origin Origin `json:"origin"`
+
+	// File and Line are the position in the config file; set if
+	// Origin is OriginFile.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+
+	// EnvVar is the name of the overriding variable, if Origin is
+	// OriginEnv; EnvVars are the variables of ${VAR} in the value.
+	EnvVar  string   `json:"env-var,omitempty"`
+	EnvVars []string `json:"env-vars,omitempty"`
+
+	// Secret tells that Value is redacted; the value was encrypted
+	// or the key holds a secret (i.e. db-password).
+	Secret bool `json:"secret,omitempty"`
+}
+
+// EnvVarName returns the name of the environment variable that
+// overrides section.key; i.e. WEBCONFIG_SITE_PORTNO for Site
+// portno, WEBCONFIG_MAINTENANCE_WINDOW for maintenance-window (which
+// has no section). Letters are upper-case and other characters
+// than letters and digits are _.
+func EnvVarName(section string, key string) string {
+	name := key
+	if section != "" {
+		name = section + "_" + key
+	}
+	return envPrefix + envName(name)
+}
+
+// Source returns where the value of section.key comes from; false
+// if it is not set (the default is in effect). section is blank for
+// the top-level keys.
+func (c *Config) Source(section string, key string) (ValueSource, bool) {
+	s := c.snapshot()
+	for i := len(s.entries) - 1; i > -1; i-- {
+		e := &s.entries[i]
+		if strings.EqualFold(e.Section, section) && (e.Key == key || (e.Section != dataSection && strings.EqualFold(e.Key, key))) {
+			return e.source(), true
+		}
+	}
+	return ValueSource{}, false
+}
+
+// Sources returns where the values in effect come from; in the
+// order of the config file, followed by the environment variables.
+func (c *Config) Sources() []ValueSource {
+	s := c.snapshot()
+
+	// The last entry of a key is in effect.
+	last := make(map[string]int)
+	for i := 0; i < len(s.entries); i++ {
+		last[strings.ToLower(s.entries[i].Section)+"."+s.entries[i].Key] = i
+	}
+
+	list := make([]ValueSource, 0, len(last))
+	for i := 0; i < len(s.entries); i++ {
+		if last[strings.ToLower(s.entries[i].Section)+"."+s.entries[i].Key] == i {
+			list = append(list, s.entries[i].source())
+		}
+	}
+	return list
+}
+
+// source returns the ValueSource of e.
+func (e *entry) source() ValueSource {
+	v := ValueSource{
+		Section: e.Section,
+		Key:     e.Key,
+		Value:   e.Value,
+		Origin:  OriginFile,
+		File:    e.File,
+		Line:    e.Line,
+		EnvVars: e.EnvVars,
+	}
+	if e.isSecret() {
+		v.Value = redacted
+		v.Secret = true
+	} else {
+		v.Value = redactValue(v.Value)
+	}
+	if e.EnvVar != "" {
+		v.Origin = OriginEnv
+		v.EnvVar = e.EnvVar
+		v.File = ""
+		v.Line = 0
+	}
+	return v
+}
+
+// expandEnv expands the ${VAR} and ${VAR:-default} in the values
+// of the entries; $${ is a literal ${. Undefined variables without a
+// default are blank and reported. The text of a heredoc (i.e. a PEM
+// or a script) is kept as it is.
+func (c *Config) expandEnv(entries []entry) {
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		if e.Heredoc || !strings.Contains(e.Value, "${") {
+			continue
+		}
+		v, vars, err := expandValue(e.Value)
+		if err != nil {
+			c.diagnostics.addf(e, SeverityError, true, "%v", err)
+		}
+		for j := 0; j < len(vars); j++ {
+			if _, ok := os.LookupEnv(vars[j]); !ok && !strings.Contains(e.Value, "${"+vars[j]+":-") {
+				c.diagnostics.addf(e, SeverityWarning, true, "environment variable %s is not set", vars[j])
+			}
+		}
+		e.Value = v
+		e.EnvVars = vars
+	}
+}
+
+// expandValue expands the ${VAR} and ${VAR:-default} in s; vars
+// are the names of the variables.
+func expandValue(s string) (string, []string, error) {
+	var sb strings.Builder
+	var vars []string
+
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			// $${ is a literal ${
+			sb.WriteString(s[:i])
+			sb.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		sb.WriteString(s[:i])
+
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return "", nil, fmt.Errorf("missing } in %q", s[i:])
+		}
+		expr := s[i+2 : i+j]
+		s = s[i+j+1:]
+
+		name, def, hasDef := strings.Cut(expr, ":-")
+		if !isEnvName(name) {
+			return "", nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		vars = append(vars, name)
+
+		v, ok := os.LookupEnv(name)
+		if (!ok || v == "") && hasDef {
+			v = def
+		}
+		sb.WriteString(v)
+	}
+
+	return sb.String(), vars, nil
+}
+
+// envOverrides returns the entries of the environment variables
+// that override the config values; see EnvVarName. A Data key is
+// matched by its variable name; if there is none in the file, the
+// key is added in lower-case with - for _.
+func (c *Config) envOverrides(entries []entry) []entry {
+	var list []entry
+
+	add := func(section string, key string, name string, value string) {
+		list = append(list, entry{Section: section, Key: key, Value: value, File: name, EnvVar: name})
+	}
+
+	for i := 0; i < len(topLevelKeys); i++ {
+		name := EnvVarName("", topLevelKeys[i])
+		if v, ok := os.LookupEnv(name); ok {
+			add("", topLevelKeys[i], name, v)
+		}
+	}
+
+	secs := make([]string, 0, len(sectionDefs))
+	for k := range sectionDefs {
+		secs = append(secs, k)
+	}
+	sort.Strings(secs)
+	for _, k := range secs {
+		def := sectionDefs[k]
+		for i := 0; i < len(def.Keys); i++ {
+			name := EnvVarName(def.Name, def.Keys[i])
+			if v, ok := os.LookupEnv(name); ok {
+				add(def.Name, def.Keys[i], name, v)
+			}
+		}
+	}
+
+	// Data
+	dataKeys := make(map[string]string)
+	for i := 0; i < len(entries); i++ {
+		if entries[i].Section == dataSection {
+			dataKeys[EnvVarName(dataSection, entries[i].Key)] = entries[i].Key
+		}
+	}
+	prefix := EnvVarName(dataSection, "")
+	env := os.Environ()
+	sort.Strings(env)
+	for i := 0; i < len(env); i++ {
+		name, v, _ := strings.Cut(env[i], "=")
+		if !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		key, ok := dataKeys[name]
+		if !ok {
+			key = strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, prefix), "_", "-"))
+		}
+		add(dataSection, key, name, v)
+	}
+
+	return list
+}
+
+// envName returns s in upper-case with _ for the characters other
+// than letters and digits.
+func envName(s string) string {
+	b := []byte(strings.ToUpper(s))
+	for i := 0; i < len(b); i++ {
+		if !(b[i] >= 'A' && b[i] <= 'Z' || b[i] >= '0' && b[i] <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func isEnvName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if !(ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
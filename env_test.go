@@ -0,0 +1,116 @@
+package webconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandValue(t *testing.T) {
+	t.Setenv("WC_HOST", "example.com")
+	t.Setenv("WC_EMPTY", "")
+
+	tests := []struct {
+		in   string
+		want string
+		vars []string
+		err  string
+	}{
+		{"plain", "plain", nil, ""},
+		{"${WC_HOST}", "example.com", []string{"WC_HOST"}, ""},
+		{"https://${WC_HOST}:${WC_PORT:-443}/", "https://example.com:443/", []string{"WC_HOST", "WC_PORT"}, ""},
+		{"${WC_EMPTY:-default}", "default", []string{"WC_EMPTY"}, ""},
+		{"${WC_EMPTY}", "", []string{"WC_EMPTY"}, ""},
+		{"${WC_UNSET}", "", []string{"WC_UNSET"}, ""},
+		{"${WC_UNSET:-}", "", []string{"WC_UNSET"}, ""},
+		{"${WC_UNSET:-a:-b}", "a:-b", []string{"WC_UNSET"}, ""},
+		{"$${WC_HOST}", "${WC_HOST}", nil, ""},
+		{"$WC_HOST", "$WC_HOST", nil, ""},
+		{"${WC_HOST", "", nil, "missing }"},
+		{"${1WC}", "", nil, "invalid environment variable name"},
+		{"${WC-HOST}", "", nil, "invalid environment variable name"},
+		{"${}", "", nil, "invalid environment variable name"},
+	}
+	for _, tt := range tests {
+		got, vars, err := expandValue(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got error %v; want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want || !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("%q: got %q %v; want %q %v", tt.in, got, vars, tt.want, tt.vars)
+		}
+	}
+}
+
+func TestEnvVarName(t *testing.T) {
+	tests := []struct {
+		section, key string
+		want         string
+	}{
+		{"Site", "portno", "WEBCONFIG_SITE_PORTNO"},
+		{"", "maintenance-window", "WEBCONFIG_MAINTENANCE_WINDOW"},
+		{"Data", "my.key", "WEBCONFIG_DATA_MY_KEY"},
+		{"URLPaths", "forward-paths", "WEBCONFIG_URLPATHS_FORWARD_PATHS"},
+	}
+	for _, tt := range tests {
+		if got := EnvVarName(tt.section, tt.key); got != tt.want {
+			t.Errorf("EnvVarName(%q, %q) = %s; want %s", tt.section, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("WC_HOST", "example.com")
+	t.Setenv("WEBCONFIG_SITE_PORTNO", "9000")
+	t.Setenv("WEBCONFIG_MAINTENANCE_WINDOW", "on")
+	t.Setenv("WEBCONFIG_DATA_DB_HOST", "db.internal")
+	t.Setenv("WEBCONFIG_DATA_NEW_KEY", "added")
+
+	c := newTestConfig(t, WithInvalidConfigPolicy(ApplyInvalidConfig))
+	s := readTestConfig(t, c, "maintenance-window off\n"+
+		"Site\n   hostname ${WC_HOST}\n   portno 80\n   proto ${WC_PROTO:-http}\n"+
+		"HTTP\n   allowed-methods GET\n"+
+		"Data\n   db_host localhost\n   url ${WC_UNSET}/x\n   literal $${WC_HOST}\n")
+
+	if s.Site.HostName != "example.com" || s.Site.Proto != "http" {
+		t.Errorf("got hostname %q, proto %q", s.Site.HostName, s.Site.Proto)
+	}
+	if s.Site.PortNo != 9000 || !s.MaintenanceWindowOn {
+		t.Errorf("got portno %d, maintenance-window %v; want the environment", s.Site.PortNo, s.MaintenanceWindowOn)
+	}
+	data := map[string]string{"db_host": "db.internal", "new-key": "added", "url": "/x", "literal": "${WC_HOST}"}
+	for k, want := range data {
+		if v, _ := s.DataValue(k); v != want {
+			t.Errorf("Data %s: got %q; want %q", k, v, want)
+		}
+	}
+
+	src, ok := s.Source("Site", "portno")
+	if !ok || src.Origin != OriginEnv || src.EnvVar != "WEBCONFIG_SITE_PORTNO" || src.Value != "9000" {
+		t.Errorf("Site portno: got %+v", src)
+	}
+	src, ok = s.Source("Site", "hostname")
+	if !ok || src.Origin != OriginFile || src.Line != 3 || !reflect.DeepEqual(src.EnvVars, []string{"WC_HOST"}) {
+		t.Errorf("Site hostname: got %+v", src)
+	}
+
+	var found bool
+	for _, d := range s.Diagnostics() {
+		if strings.Contains(d.Message, "WC_UNSET is not set") {
+			found = d.Severity == SeverityWarning && d.Line == 10
+		}
+		if strings.Contains(d.Message, "WC_PROTO") {
+			t.Errorf("a variable with a default is reported: %v", d)
+		}
+	}
+	if !found {
+		t.Errorf("no warning for WC_UNSET: %v", s.Diagnostics())
+	}
+}
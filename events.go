@@ -0,0 +1,274 @@
+package webconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeFunc is called after a new config has been applied. old and
+// new are snapshots (see Snapshot); changed holds the names of the
+// values that differ in the section.key form, i.e. Site.portno,
+// Data.my-key; top-level keys have no section (maintenance-window).
+// The keys of the custom sections are compared as well, so a change
+// to a struct of Bind is reported by its keys (i.e. Uploads.timeout).
+// A change to the blocked-ip file is reported as blocked-ip and one
+// to the maintenance page as maint-page.html.
+type ChangeFunc func(old *Config, new *Config, changed []string)
+
+// ChangeEvent is sent to the channels of WatchChanges.
+type ChangeEvent struct {
+	Old     *Config
+	New     *Config
+	Changed []string
+}
+
+// changeSubs holds the subscribers and the events that are
+// waiting to be delivered. The events are delivered in order by
+// one goroutine, so a subscriber can safely update the config.
+type changeSubs struct {
+	mu      sync.Mutex
+	fns     map[int]ChangeFunc
+	nextID  int
+	pending []ChangeEvent
+	notify  chan struct{}
+	running bool
+	closed  bool
+}
+
+// OnChange registers fn to be called after each reload that
+// changed at least one value. The calls are made in order from a
+// goroutine of the Config (not the one that caused the reload).
+// The returned func removes the subscription.
+func (c *Config) OnChange(fn ChangeFunc) (cancel func()) {
+	c = c.root()
+	rt := c.state()
+	subs := &rt.subs
+
+	subs.mu.Lock()
+	if subs.fns == nil {
+		subs.fns = make(map[int]ChangeFunc)
+		subs.notify = make(chan struct{}, 1)
+	}
+	id := subs.nextID
+	subs.nextID++
+	subs.fns[id] = fn
+	subs.mu.Unlock()
+
+	c.startDispatcher()
+
+	return func() {
+		subs.mu.Lock()
+		delete(subs.fns, id)
+		subs.mu.Unlock()
+	}
+}
+
+// WatchChanges is the channel variant of OnChange. Events are
+// dropped if the channel buffer is full. The returned func removes
+// the subscription and closes the channel.
+func (c *Config) WatchChanges(buffer int) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, buffer)
+
+	var mu sync.Mutex
+	closed := false
+
+	cancel := c.OnChange(func(old *Config, new *Config, changed []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- ChangeEvent{Old: old, New: new, Changed: changed}:
+		default:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			cancel()
+			mu.Lock()
+			closed = true
+			close(ch)
+			mu.Unlock()
+		})
+	}
+}
+
+// startDispatcher starts the goroutine that delivers the events;
+// once per Config. It takes only subs.mu, so a subscription can be
+// made while rt.mu is held (i.e. in the fn of Update).
+func (c *Config) startDispatcher() {
+	rt := c.rt
+	subs := &rt.subs
+
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	if subs.running || subs.closed {
+		return
+	}
+	subs.running = true
+
+	rt.wg.Add(1)
+	go c.dispatchChanges()
+}
+
+// dispatchChanges delivers the pending events to the subscribers
+// until Close is called.
+func (c *Config) dispatchChanges() {
+	rt := c.rt
+	subs := &rt.subs
+	defer rt.wg.Done()
+
+	for {
+		select {
+		case <-rt.stop:
+			return
+		case <-subs.notify:
+		}
+
+		subs.mu.Lock()
+		events := subs.pending
+		subs.pending = nil
+		subs.mu.Unlock()
+
+		for i := 0; i < len(events); i++ {
+			subs.mu.Lock()
+			ids := make([]int, 0, len(subs.fns))
+			for id := range subs.fns {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			fns := make([]ChangeFunc, 0, len(ids))
+			for j := 0; j < len(ids); j++ {
+				fns = append(fns, subs.fns[ids[j]])
+			}
+			subs.mu.Unlock()
+
+			for j := 0; j < len(fns); j++ {
+				fns[j](events[i].Old, events[i].New, events[i].Changed)
+			}
+		}
+	}
+}
+
+// publishChange queues the change from old to new for the
+// subscribers; nothing is queued if there are none or nothing
+// has changed.
+func (c *Config) publishChange(old *Config, new *Config) {
+	subs := &c.rt.subs
+
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	if len(subs.fns) == 0 {
+		return
+	}
+
+	changed := diffConfig(old, new)
+	if len(changed) == 0 {
+		return
+	}
+
+	subs.pending = append(subs.pending, ChangeEvent{Old: old, New: new, Changed: changed})
+	select {
+	case subs.notify <- struct{}{}:
+	default:
+	}
+}
+
+// diffConfig returns the names of the values that differ
+// between old and new; sorted.
+func diffConfig(old *Config, new *Config) []string {
+	a := old.keyValues()
+	b := new.keyValues()
+
+	var changed []string
+	for k, v := range a {
+		if x, ok := b[k]; !ok || x != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	if old.blockedIPHash != new.blockedIPHash {
+		changed = append(changed, blockedIPFileName)
+	}
+	if old.maintPageHash != new.maintPageHash {
+		changed = append(changed, maintPageFileName)
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// keyValues returns the config values by their names in the
+// config file (section.key); the keys of the custom sections are
+// included.
+func (c *Config) keyValues() map[string]string {
+	list := func(v []string) string {
+		return strings.Join(v, ",")
+	}
+	timeStr := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	condSvc, _ := json.Marshal(c.URLPaths.ServeOnlyTo)
+
+	m := map[string]string{
+		"maintenance-window":     onOff(c.MaintenanceWindowOn),
+		"redirect-http-to-https": onOff(c.RedirectHTTPtoHTTPS),
+
+		"Site.hostname":            c.Site.HostName,
+		"Site.alternate-hostnames": list(c.Site.AlternateHostNames),
+		"Site.portno":              fmt.Sprint(c.Site.PortNo),
+		"Site.proto":               c.Site.Proto,
+
+		"TLS.cert": c.TLS.CertFilePath,
+		"TLS.key":  c.TLS.KeyFilePath,
+
+		"Maintenance.start":        timeStr(c.Maintenance.Start),
+		"Maintenance.end":          timeStr(c.Maintenance.End),
+		"Maintenance.retry-after":  fmt.Sprint(c.Maintenance.RetryAfter),
+		"Maintenance.bypass-ip":    list(c.Maintenance.BypassIP),
+		"Maintenance.bypass-paths": list(c.Maintenance.BypassPaths),
+
+		"Admin.allowed-ip-addr": list(c.Admin.AllowedIP),
+		"Admin.run-on-startup":  yesNo(c.Admin.RunOnStartup),
+		"Admin.portno":          fmt.Sprint(c.Admin.PortNo),
+
+		"MessageBanner.display-mode":       onOff(c.MessageBanner.On),
+		"MessageBanner.seconds-to-display": fmt.Sprint(c.MessageBanner.SecondsToDisplay),
+
+		"URLPaths.restrict-paths":           list(c.URLPaths.Restrict),
+		"URLPaths.exclude-paths":            list(c.URLPaths.Exclude),
+		"URLPaths.forward-paths":            list(c.URLPaths.Forward),
+		"URLPaths.conditional-http-service": string(condSvc),
+
+		"HTTP.allowed-methods": list(c.HTTP.AllowedMethods),
+		"HTTP.trusted-proxies": list(c.HTTP.TrustedProxies),
+	}
+	for k, v := range c.Data {
+		m["Data."+k] = v
+	}
+	for i := 0; i < len(c.entries); i++ {
+		e := c.entries[i]
+		if _, ok := sectionDefs[strings.ToLower(e.Section)]; ok || e.Section == "" {
+			continue
+		}
+		m[e.Section+"."+e.Key] = e.Value
+	}
+
+	return m
+}
@@ -0,0 +1,113 @@
+package webconfig
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitChange returns the next event of ch; the test fails if there
+// is none in time.
+func waitChange(t *testing.T, ch <-chan ChangeEvent) ChangeEvent {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+	return ChangeEvent{}
+}
+
+func TestOnChange(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	ch, cancel := c.WatchChanges(10)
+	defer cancel()
+
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+	ev := waitChange(t, ch)
+	if strings.Join(ev.Changed, " ") != "Site.portno" {
+		t.Errorf("got %v; want [Site.portno]", ev.Changed)
+	}
+	if ev.Old.Site.PortNo != 8085 || ev.New.Site.PortNo != 9000 {
+		t.Errorf("got old %d, new %d; want 8085, 9000", ev.Old.Site.PortNo, ev.New.Site.PortNo)
+	}
+
+	if err := c.Set("", "redirect-http-to-https", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitChange(t, ch); strings.Join(ev.Changed, " ") != "redirect-http-to-https" {
+		t.Errorf("got %v; want [redirect-http-to-https]", ev.Changed)
+	}
+
+	if err := os.WriteFile(c.maintPagePath(), []byte("<p>back soon</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.Refresh()
+	if ev := waitChange(t, ch); strings.Join(ev.Changed, " ") != maintPageFileName {
+		t.Errorf("got %v; want [%s]", ev.Changed, maintPageFileName)
+	}
+}
+
+// TestOnChangeBind changes a key of a bound section.
+func TestOnChangeBind(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	f, err := os.OpenFile(c.ConfigFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\nUploads\n\ttimeout 30s\n")
+	f.Close()
+
+	var uploads struct {
+		Timeout time.Duration `webcfg:"timeout"`
+	}
+	if err := c.Bind("Uploads", &uploads); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, cancel := c.WatchChanges(10)
+	defer cancel()
+	if err := c.Set("Uploads", "timeout", "45s"); err != nil {
+		t.Fatal(err)
+	}
+	ev := waitChange(t, ch)
+	if strings.Join(ev.Changed, " ") != "Uploads.timeout" {
+		t.Errorf("got %v; want [Uploads.timeout]", ev.Changed)
+	}
+	if uploads.Timeout != 45*time.Second {
+		t.Errorf("got timeout %v; want 45s", uploads.Timeout)
+	}
+}
+
+// TestOnChangeInUpdate subscribes in the fn of Update, which runs
+// with the config locked.
+func TestOnChangeInUpdate(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+
+	var ch <-chan ChangeEvent
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Update(func(tx *Tx) error {
+			var cancel func()
+			ch, cancel = c.WatchChanges(10)
+			t.Cleanup(cancel)
+			return tx.Set("Site", "portno", "9000")
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Update did not return; deadlock")
+	}
+	if ev := waitChange(t, ch); strings.Join(ev.Changed, " ") != "Site.portno" {
+		t.Errorf("got %v; want [Site.portno]", ev.Changed)
+	}
+}
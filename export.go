@@ -0,0 +1,226 @@
+package webconfig
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteTo writes the values of the fields of c as a config file in
+// the free-style format; the comments of the default config are
+// kept, so the output can be the config of a new site:
+//
+//	cfg := &webconfig.Config{}
+//	cfg.Site.HostName = "mydomain.com"
+//	cfg.Site.PortNo = 443
+//	cfg.Data = map[string]string{"my-key": "my value"}
+//	_, err := cfg.WriteTo(f)
+//
+// The keys of Data are written in the order of the config file (the
+// others after them, sorted) and the custom sections that were read
+// are written as they are. The values that were encrypted in the
+// config file are encrypted again; see EncryptValue. For the Config
+// returned by NewWebConfig, the current snapshot is written (the
+// config in effect); see Snapshot.
+//
+// The fields that are not valid when zero keep the value of the
+// default config if they're not set: Site.PortNo (8085), Site.Proto
+// (http) and HTTP.AllowedMethods. The others are written as they are;
+// i.e. an Admin.PortNo of 0 does not serve the admin website on a port
+// of its own. The output is validated as the config file is (the TLS
+// files must exist); if it has errors, nothing is written and the
+// error is a *ValidationError.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	c = c.snapshot()
+	b, err := c.encode()
+	if err != nil {
+		return 0, err
+	}
+	if diags := c.check(b); HasErrors(diags) {
+		return 0, &ValidationError{Diagnostics: diags}
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// encode returns the config file of WriteTo; the values are set in
+// the syntax tree of the default config.
+func (c *Config) encode() ([]byte, error) {
+	values, err := c.fileValues()
+	if err != nil {
+		return nil, err
+	}
+
+	f := parseAST("", []byte(cfgTemplateAll))
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		if v.Section != "" && f.findSection(v.Section) == nil {
+			f.addSection(v.Section)
+		}
+		// The keys of the default config are rewritten only if the
+		// value is not the same; the blank keys that are not in it (i.e.
+		// the TLS files) are left out.
+		n := f.findKey(v.Section, v.Key)
+		if n != nil && n.value == v.Value {
+			continue
+		}
+		def, builtIn := sectionDefs[strings.ToLower(v.Section)]
+		if n == nil && v.Value == "" && (v.Section == "" || builtIn && def.Keys != nil) {
+			continue
+		}
+		if err := f.set(v.Section, v.Key, v.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.bytes(), nil
+}
+
+// defaultIfZero are the keys (section.key) that are not valid with
+// the value of a zero field; the value of the default config is kept.
+var defaultIfZero = map[string]string{
+	"site.portno":          "0",
+	"site.proto":           "",
+	"http.allowed-methods": "",
+}
+
+// fileValues returns the key/values of the fields of c as they're
+// written in the config file; see keyValues.
+func (c *Config) fileValues() ([]KeyValue, error) {
+	serveOnlyTo := ""
+	if len(c.URLPaths.ServeOnlyTo) > 0 {
+		b, err := marshalJSON(c.URLPaths.ServeOnlyTo)
+		if err != nil {
+			return nil, err
+		}
+		serveOnlyTo = string(b)
+	}
+
+	values := []KeyValue{
+		{Key: "maintenance-window", Value: onOff(c.MaintenanceWindowOn)},
+		{Key: "redirect-http-to-https", Value: onOff(c.RedirectHTTPtoHTTPS)},
+		{Section: "Site", Key: "hostname", Value: c.Site.HostName},
+		{Section: "Site", Key: "alternate-hostnames", Value: strings.Join(c.Site.AlternateHostNames, ", ")},
+		{Section: "Site", Key: "portno", Value: strconv.Itoa(c.Site.PortNo)},
+		{Section: "Site", Key: "proto", Value: c.Site.Proto},
+		{Section: "TLS", Key: "cert", Value: c.TLS.CertFilePath},
+		{Section: "TLS", Key: "key", Value: c.TLS.KeyFilePath},
+		{Section: "Maintenance", Key: "start", Value: formatMaintTime(c.Maintenance.Start)},
+		{Section: "Maintenance", Key: "end", Value: formatMaintTime(c.Maintenance.End)},
+		{Section: "Maintenance", Key: "retry-after", Value: strconv.Itoa(c.Maintenance.RetryAfter)},
+		{Section: "Maintenance", Key: "bypass-ip", Value: strings.Join(c.Maintenance.BypassIP, ", ")},
+		{Section: "Maintenance", Key: "bypass-paths", Value: strings.Join(c.Maintenance.BypassPaths, ", ")},
+		{Section: "Admin", Key: "allowed-ip-addr", Value: strings.Join(c.Admin.AllowedIP, ", ")},
+		{Section: "Admin", Key: "run-on-startup", Value: yesNo(c.Admin.RunOnStartup)},
+		{Section: "Admin", Key: "portno", Value: strconv.FormatUint(uint64(c.Admin.PortNo), 10)},
+		{Section: "MessageBanner", Key: "display-mode", Value: onOff(c.MessageBanner.On)},
+		{Section: "MessageBanner", Key: "seconds-to-display", Value: strconv.Itoa(c.MessageBanner.SecondsToDisplay)},
+		{Section: "URLPaths", Key: "restrict-paths", Value: strings.Join(c.URLPaths.Restrict, ", ")},
+		{Section: "URLPaths", Key: "exclude-paths", Value: strings.Join(c.URLPaths.Exclude, ", ")},
+		{Section: "URLPaths", Key: "forward-paths", Value: strings.Join(c.URLPaths.Forward, ", ")},
+		{Section: "URLPaths", Key: "conditional-http-service", Value: serveOnlyTo},
+		{Section: "HTTP", Key: "allowed-methods", Value: strings.Join(c.HTTP.AllowedMethods, ", ")},
+		{Section: "HTTP", Key: "trusted-proxies", Value: strings.Join(c.HTTP.TrustedProxies, ", ")},
+	}
+	list := values[:0]
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		if zero, ok := defaultIfZero[strings.ToLower(v.Section)+"."+v.Key]; !ok || v.Value != zero {
+			list = append(list, v)
+		}
+	}
+	values = list
+
+	// Data; in the order of the file.
+	s := c.snapshot()
+	var keys []string
+	seen := make(map[string]bool, len(c.Data))
+	for i := 0; i < len(s.dataKeys); i++ {
+		if _, ok := c.Data[s.dataKeys[i]]; ok {
+			keys = append(keys, s.dataKeys[i])
+			seen[s.dataKeys[i]] = true
+		}
+	}
+	var rest []string
+	for k := range c.Data {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+	for i := 0; i < len(keys); i++ {
+		values = append(values, KeyValue{Section: dataSection, Key: keys[i], Value: c.Data[keys[i]]})
+	}
+
+	// The custom sections.
+	for i := 0; i < len(s.entries); i++ {
+		e := s.entries[i]
+		if _, ok := sectionDefs[strings.ToLower(e.Section)]; ok || e.Section == "" {
+			continue
+		}
+		values = append(values, KeyValue{Section: e.Section, Key: e.Key, Value: e.Value})
+	}
+
+	return c.encryptSecrets(values)
+}
+
+// encryptSecrets encrypts the values that were encrypted in the
+// config file.
+func (c *Config) encryptSecrets(values []KeyValue) ([]KeyValue, error) {
+	s := c.snapshot()
+	secret := make(map[string]bool)
+	for i := 0; i < len(s.entries); i++ {
+		if s.entries[i].Secret {
+			secret[strings.ToLower(s.entries[i].Section)+"."+s.entries[i].Key] = true
+		}
+	}
+	if len(secret) == 0 {
+		return values, nil
+	}
+
+	key, err := c.secretKey(false)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(values); i++ {
+		v := &values[i]
+		if !secret[strings.ToLower(v.Section)+"."+v.Key] || v.Value == "" {
+			continue
+		}
+		if v.Value, err = encryptValue(key, v.Value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// formatMaintTime returns the start/end time as it's written in the
+// config file; blank if t is zero.
+func formatMaintTime(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case t.Location() != time.Local:
+		return t.Format(time.RFC3339)
+	case t.Second() != 0:
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
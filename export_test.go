@@ -0,0 +1,141 @@
+package webconfig
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   func(c *Config)
+		check func(s *Config) bool
+	}{
+		{"zero", func(c *Config) {}, func(s *Config) bool {
+			return s.Site.PortNo == 8085 && s.Site.Proto == "http" && len(s.HTTP.AllowedMethods) == 4 &&
+				s.Admin.PortNo == 0 && s.Maintenance.RetryAfter == 0
+		}},
+		{"new site", func(c *Config) {
+			c.Site.HostName = "mydomain.com"
+			c.Site.PortNo = 443
+		}, func(s *Config) bool {
+			return s.Site.HostName == "mydomain.com" && s.Site.PortNo == 443 && s.Site.Proto == "http" &&
+				strings.Join(s.HTTP.AllowedMethods, ",") == "GET,OPTIONS,CONNECT,HEAD"
+		}},
+		{"values", func(c *Config) {
+			c.Site.Proto = "https"
+			c.MaintenanceWindowOn = true
+			c.HTTP.AllowedMethods = []string{"GET", "POST"}
+			c.Admin.PortNo = 9000
+			c.Maintenance.RetryAfter = 60
+			c.Data = map[string]string{"b": "2", "a": "multi\nline"}
+		}, func(s *Config) bool {
+			a, _ := s.DataValue("a")
+			return s.Site.Proto == "https" && s.MaintenanceWindowOn && strings.Join(s.HTTP.AllowedMethods, ",") == "GET,POST" &&
+				s.Admin.PortNo == 9000 && s.Maintenance.RetryAfter == 60 && a == "multi\nline" && s.DataSection().GetString("b", "") == "2"
+		}},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		tt.cfg(cfg)
+		var buf bytes.Buffer
+		if _, err := cfg.WriteTo(&buf); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), "# ") {
+			t.Errorf("%s: the comments of the default config are not kept", tt.name)
+		}
+
+		c := newTestConfig(t)
+		s := readTestConfig(t, c, buf.String())
+		if d := s.Diagnostics(); HasErrors(d) {
+			t.Errorf("%s: %v\n%s", tt.name, d, buf.String())
+			continue
+		}
+		if !tt.check(s) {
+			t.Errorf("%s: the values are not read back:\n%s", tt.name, buf.String())
+		}
+	}
+}
+
+func TestWriteToSnapshot(t *testing.T) {
+	c := newTestConfig(t)
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.Snapshot().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(c.ConfigFilePath)
+	if buf.String() != string(b) {
+		t.Errorf("got\n%s\nwant the config file\n%s", buf.String(), b)
+	}
+}
+
+// TestWriteToRoot writes the Config returned by NewWebConfig; the
+// current snapshot is written.
+func TestWriteToRoot(t *testing.T) {
+	c := newTestConfig(t)
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("Data", "newkey", "v1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s := readTestConfig(t, newTestConfig(t), buf.String())
+	if s.Site.PortNo != 9000 {
+		t.Errorf("got portno %d; want 9000", s.Site.PortNo)
+	}
+	if v, _ := s.DataValue("newkey"); v != "v1" {
+		t.Errorf("got newkey %q; want v1", v)
+	}
+}
+
+func TestWriteToInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(c *Config)
+		key  string
+	}{
+		{"proto", func(c *Config) { c.Site.Proto = "ftp" }, "proto"},
+		{"portno", func(c *Config) { c.Site.PortNo = 70000 }, "portno"},
+		{"method", func(c *Config) { c.HTTP.AllowedMethods = []string{"get"} }, "allowed-methods"},
+		{"tls", func(c *Config) {
+			c.TLS.CertFilePath = filepath.Join(t.TempDir(), "cert.pem")
+			c.TLS.KeyFilePath = c.TLS.CertFilePath
+		}, "cert"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{}
+		tt.cfg(cfg)
+		var buf bytes.Buffer
+		n, err := cfg.WriteTo(&buf)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: got %v; want a *ValidationError", tt.name, err)
+			continue
+		}
+		if n != 0 || buf.Len() != 0 {
+			t.Errorf("%s: %d bytes were written", tt.name, n)
+		}
+		found := false
+		for _, d := range verr.Diagnostics {
+			found = found || d.Key == tt.key && d.Severity == SeverityError
+		}
+		if !found {
+			t.Errorf("%s: no error for %s: %v", tt.name, tt.key, verr)
+		}
+	}
+}
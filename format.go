@@ -0,0 +1,548 @@
+package webconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// KeyValue is a key and its value in a config file; Section is blank
+// for the keys that are not in a section (i.e. maintenance-window).
+// The values are as in the free-style format; i.e. lists are
+// comma-separated. Line is the line number in the file, if known. A
+// KeyValue with a blank Key is a section without keys.
+type KeyValue struct {
+	Section string
+	Key     string
+	Value   string
+	Line    int
+}
+
+// Format reads and writes the config file in a file format; see
+// RegisterFormat and WithFormat. The built-in formats are all (the
+// free-style format), json, yaml and toml.
+type Format interface {
+	// Extensions are the file extensions of the format; i.e. .yaml
+	// and .yml.
+	Extensions() []string
+
+	// Decode returns the key/values of a config file, in the order
+	// of the file; a *FormatError tells where a syntax error is.
+	Decode(data []byte) ([]KeyValue, error)
+
+	// Encode returns a config file with the key/values.
+	Encode(values []KeyValue) ([]byte, error)
+}
+
+// FormatError is a syntax error in a config file.
+type FormatError struct {
+	Line int
+	Msg  string
+}
+
+func (e *FormatError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{
+		"all":  allFormat{},
+		"json": jsonFormat{},
+		"yaml": yamlFormat{},
+		"toml": tomlFormat{},
+	}
+)
+
+// RegisterFormat adds a format (or replaces a built-in one); name
+// is case-insensitive.
+func RegisterFormat(name string, f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats[strings.ToLower(name)] = f
+}
+
+// Convert converts a config file from a format to another; i.e.
+//
+//	b, err := webconfig.Convert(data, "all", "yaml")
+//
+// The comments are not converted.
+func Convert(data []byte, from string, to string) ([]byte, error) {
+	ff, err := lookupFormat(from)
+	if err != nil {
+		return nil, err
+	}
+	ft, err := lookupFormat(to)
+	if err != nil {
+		return nil, err
+	}
+	values, err := ff.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return ft.Encode(values)
+}
+
+func lookupFormat(name string) (Format, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	if f, ok := formats[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unknown config format %q", name)
+}
+
+// formatOfPath returns the format of a file by its extension; the
+// free-style format if there is no other.
+func formatOfPath(path string) Format {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for name, f := range formats {
+		if name == "all" {
+			continue
+		}
+		list := f.Extensions()
+		for i := 0; i < len(list); i++ {
+			if strings.EqualFold(list[i], ext) {
+				return f
+			}
+		}
+	}
+	return allFormat{}
+}
+
+// fileFormat returns the format of the file path; the config file
+// is in the format of WithFormat, if it's set.
+func (c *Config) fileFormat(path string) Format {
+	root := c.root()
+	if root.rt != nil && root.rt.format != nil && filepath.Clean(path) == filepath.Clean(root.ConfigFilePath) {
+		return root.rt.format
+	}
+	return formatOfPath(path)
+}
+
+func isAllFormat(f Format) bool {
+	_, ok := f.(allFormat)
+	return ok
+}
+
+// decodeAST returns the syntax tree of a config file in the format
+// f; the keys are placed in their sections as in the free-style
+// format (see parseAST). A syntax error is returned for the formats
+// other than the free-style one.
+func decodeAST(name string, f Format, data []byte) (*astFile, error) {
+	if isAllFormat(f) {
+		return parseAST(name, data), nil
+	}
+	values, err := f.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return astOfValues(name, values), nil
+}
+
+// astOfValues returns the syntax tree of the key/values of a file
+// in another format than the free-style one.
+func astOfValues(name string, values []KeyValue) *astFile {
+	a := &astFile{name: name}
+
+	sections := make(map[string]*astNode)
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+
+		var sec *astNode
+		if v.Section != "" {
+			lname := strings.ToLower(v.Section)
+			sec = sections[lname]
+			if sec == nil {
+				sec = &astNode{kind: nodeSection, token: token{kind: tokKey, key: v.Section, line: v.Line, col: 1}}
+				sec.section = v.Section
+				if def, ok := sectionDefs[lname]; ok {
+					sec.section = def.Name
+				} else {
+					a.diags.addf(a.entry(sec), SeverityWarning, false, "unknown section %q", v.Section)
+				}
+				sections[lname] = sec
+				a.nodes = append(a.nodes, sec)
+			}
+		}
+		if v.Key == "" {
+			continue
+		}
+
+		n := &astNode{kind: nodeKey, token: token{kind: tokKey, key: v.Key, value: v.Value, line: v.Line, col: 1, valueCol: 1}}
+		a.placeKey(n, sec)
+		if sec != nil {
+			sec.children = append(sec.children, n)
+		} else {
+			a.nodes = append(a.nodes, n)
+		}
+	}
+
+	return a
+}
+
+// encodeAST returns the content of the syntax tree in the format f.
+func encodeAST(f Format, a *astFile) ([]byte, error) {
+	if isAllFormat(f) {
+		return a.bytes(), nil
+	}
+	return f.Encode(a.values())
+}
+
+// values returns the key/values of the file; the keys that could not
+// be placed in a section are included.
+func (f *astFile) values() []KeyValue {
+	var list []KeyValue
+	for i := 0; i < len(f.nodes); i++ {
+		n := f.nodes[i]
+		switch n.kind {
+		case nodeKey:
+			list = append(list, KeyValue{Key: n.key, Value: n.value, Line: n.line})
+		case nodeSection:
+			keys := 0
+			for j := 0; j < len(n.children); j++ {
+				if k := n.children[j]; k.kind == nodeKey {
+					list = append(list, KeyValue{Section: n.section, Key: k.key, Value: k.value, Line: k.line})
+					keys++
+				}
+			}
+			if keys == 0 {
+				list = append(list, KeyValue{Section: n.section, Line: n.line})
+			}
+		}
+	}
+	return list
+}
+
+// allFormat is the free-style format of the .all file.
+type allFormat struct{}
+
+func (allFormat) Extensions() []string {
+	return []string{".all", confFileExt}
+}
+
+func (allFormat) Decode(data []byte) ([]KeyValue, error) {
+	a := parseAST("", data)
+	for i := 0; i < len(a.diags); i++ {
+		if a.diags[i].Severity == SeverityError {
+			return nil, &FormatError{Line: a.diags[i].Line, Msg: a.diags[i].Message}
+		}
+	}
+	return a.values(), nil
+}
+
+// Encode writes the keys without a section first; then the sections
+// with the keys indented. A name (of a section or key) must be one
+// word that does not begin with # or end with \.
+func (allFormat) Encode(values []KeyValue) ([]byte, error) {
+	var b bytes.Buffer
+
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		if !isAllName(v.Section) || !isAllName(v.Key) {
+			return nil, &FormatError{Line: v.Line, Msg: fmt.Sprintf("%q %q cannot be a name in the free-style format", v.Section, v.Key)}
+		}
+	}
+
+	for i := 0; i < len(values); i++ {
+		if v := values[i]; v.Section == "" && v.Key != "" {
+			writeKeyValue(&b, "", v.Key, v.Value)
+		}
+	}
+
+	var sections []string
+	keys := make(map[string][]KeyValue)
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		if v.Section == "" {
+			continue
+		}
+		if _, ok := keys[v.Section]; !ok {
+			sections = append(sections, v.Section)
+			keys[v.Section] = nil
+		}
+		if v.Key != "" {
+			keys[v.Section] = append(keys[v.Section], v)
+		}
+	}
+	for i := 0; i < len(sections); i++ {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(sections[i] + "\n")
+		list := keys[sections[i]]
+		for j := 0; j < len(list); j++ {
+			writeKeyValue(&b, "   ", list[j].Key, list[j].Value)
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// isAllName tells if s can be the name of a section or key in the
+// free-style format; blank is for none.
+func isAllName(s string) bool {
+	return s == "" || !hasControl(s) && !strings.ContainsAny(s, " \t") && s[0] != '#' && s[len(s)-1] != '\\'
+}
+
+// writeKeyValue writes a key/value line; a blank value is written as
+// "" if the key alone would be read as a section header.
+func writeKeyValue(b *bytes.Buffer, indent string, key string, value string) {
+	b.WriteString(indent + key)
+	lkey := strings.ToLower(key)
+	_, isSection := sectionDefs[lkey]
+	switch {
+	case value != "":
+		b.WriteString(" " + formatValue(value, indent, "\n"))
+	case isSection, indent == "" && !isTopLevelKey(lkey) && len(sectionsOfKey(lkey)) == 0:
+		b.WriteString(` ""`)
+	}
+	b.WriteString("\n")
+}
+
+// The structured formats (json, yaml and toml) are read into a tree
+// of *omap, []interface{}, string, json.Number, bool and nil values;
+// a section is an object.
+
+// omap is an object; the keys are in the order of the file and
+// lines are their line numbers.
+type omap struct {
+	keys  []string
+	vals  map[string]interface{}
+	lines map[string]int
+}
+
+func newOmap() *omap {
+	return &omap{vals: make(map[string]interface{}), lines: make(map[string]int)}
+}
+
+func (m *omap) set(key string, v interface{}, line int) {
+	if _, ok := m.vals[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.vals[key] = v
+	m.lines[key] = line
+}
+
+func (m *omap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i := 0; i < len(m.keys); i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := marshalJSON(m.keys[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := marshalJSON(m.vals[m.keys[i]])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalJSON is json.Marshal without the escapes of <, > and &.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// treeValues returns the key/values of a tree; the objects at the
+// top are the sections.
+func treeValues(root *omap) ([]KeyValue, error) {
+	var list []KeyValue
+	for i := 0; i < len(root.keys); i++ {
+		k := root.keys[i]
+		sec, ok := root.vals[k].(*omap)
+		if !ok {
+			v, err := flatValue(root.vals[k])
+			if err != nil {
+				return nil, &FormatError{Line: root.lines[k], Msg: err.Error()}
+			}
+			list = append(list, KeyValue{Key: k, Value: v, Line: root.lines[k]})
+			continue
+		}
+		if len(sec.keys) == 0 {
+			list = append(list, KeyValue{Section: k, Line: root.lines[k]})
+		}
+		for j := 0; j < len(sec.keys); j++ {
+			kk := sec.keys[j]
+			v, err := flatValue(sec.vals[kk])
+			if err != nil {
+				return nil, &FormatError{Line: sec.lines[kk], Msg: err.Error()}
+			}
+			list = append(list, KeyValue{Section: k, Key: kk, Value: v, Line: sec.lines[kk]})
+		}
+	}
+	return list, nil
+}
+
+// flatValue returns the free-style value of v; a list of scalars is
+// comma-separated, other lists and objects are JSON.
+func flatValue(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case json.Number:
+		return x.String(), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case []interface{}:
+		list := make([]string, 0, len(x))
+		for i := 0; i < len(x); i++ {
+			switch x[i].(type) {
+			case []interface{}, *omap:
+				b, err := marshalJSON(x)
+				return string(b), err
+			}
+			s, _ := flatValue(x[i])
+			list = append(list, s)
+		}
+		return strings.Join(list, ", "), nil
+	case *omap:
+		b, err := marshalJSON(x)
+		return string(b), err
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// listKeys, intKeys and boolKeys are the keys (section.key) that are
+// written as lists, numbers and booleans in the structured formats;
+// the other values are strings.
+var (
+	listKeys = map[string]bool{
+		"site.alternate-hostnames": true,
+		"maintenance.bypass-ip":    true,
+		"maintenance.bypass-paths": true,
+		"admin.allowed-ip-addr":    true,
+		"urlpaths.restrict-paths":  true,
+		"urlpaths.exclude-paths":   true,
+		"urlpaths.forward-paths":   true,
+		"http.allowed-methods":     true,
+		"http.trusted-proxies":     true,
+	}
+	intKeys = map[string]bool{
+		"site.portno":                      true,
+		"admin.portno":                     true,
+		"maintenance.retry-after":          true,
+		"messagebanner.seconds-to-display": true,
+	}
+	boolKeys = map[string]bool{
+		".maintenance-window":        true,
+		".redirect-http-to-https":    true,
+		"admin.run-on-startup":       true,
+		"messagebanner.display-mode": true,
+	}
+)
+
+// checkUTF8 returns the error of data that is not UTF-8; the
+// structured formats are text in UTF-8.
+func checkUTF8(data []byte) error {
+	if utf8.Valid(data) {
+		return nil
+	}
+	line := 1
+	for len(data) > 0 {
+		r, n := utf8.DecodeRune(data)
+		if r == utf8.RuneError && n == 1 {
+			break
+		}
+		if r == '\n' {
+			line++
+		}
+		data = data[n:]
+	}
+	return &FormatError{Line: line, Msg: "the text is not valid UTF-8"}
+}
+
+// valuesTree returns the tree of the key/values; see treeValues.
+// The values must be UTF-8.
+func valuesTree(values []KeyValue) (*omap, error) {
+	root := newOmap()
+	for i := 0; i < len(values); i++ {
+		v := values[i]
+		if !utf8.ValidString(v.Section) || !utf8.ValidString(v.Key) || !utf8.ValidString(v.Value) {
+			return nil, &FormatError{Line: v.Line, Msg: fmt.Sprintf("%s %s is not valid UTF-8", v.Section, v.Key)}
+		}
+		if v.Section == "" {
+			if v.Key != "" {
+				root.set(v.Key, typedValue("", v.Key, v.Value), v.Line)
+			}
+			continue
+		}
+		sec, ok := root.vals[v.Section].(*omap)
+		if !ok {
+			sec = newOmap()
+			root.set(v.Section, sec, v.Line)
+		}
+		if v.Key != "" {
+			sec.set(v.Key, typedValue(v.Section, v.Key, v.Value), v.Line)
+		}
+	}
+	return root, nil
+}
+
+// typedValue returns the value of section.key in the tree.
+func typedValue(section string, key string, v string) interface{} {
+	name := strings.ToLower(section) + "." + strings.ToLower(key)
+	switch {
+	case listKeys[name]:
+		list := splitList(v)
+		items := make([]interface{}, len(list))
+		for i := 0; i < len(list); i++ {
+			items[i] = list[i]
+		}
+		return items
+
+	case name == "urlpaths.conditional-http-service":
+		if strings.TrimSpace(v) == "" {
+			return []interface{}{}
+		}
+		if x, err := decodeJSONValue([]byte(v)); err == nil {
+			return x
+		}
+
+	case intKeys[name]:
+		// A number only in its canonical form; i.e. 0080 and +80 are
+		// not numbers in JSON and TOML.
+		if n, err := strconv.Atoi(v); err == nil && strconv.Itoa(n) == v {
+			return json.Number(v)
+		}
+
+	case boolKeys[name]:
+		if b, ok := parseBool(v); ok && v != "" {
+			return b
+		}
+	}
+	return v
+}
+
+var errNotObject = errors.New("the config must be an object (a map of sections)")
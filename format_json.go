@@ -0,0 +1,146 @@
+package webconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonFormat reads and writes the config as a JSON object of
+// sections; i.e.
+//
+//	{
+//	  "maintenance-window": false,
+//	  "Site": {"hostname": "localhost", "portno": 8085, "proto": "http"}
+//	}
+type jsonFormat struct{}
+
+func (jsonFormat) Extensions() []string {
+	return []string{".json"}
+}
+
+func (jsonFormat) Decode(data []byte) ([]KeyValue, error) {
+	if err := checkUTF8(data); err != nil {
+		return nil, err
+	}
+	d := &jsonDecoder{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	d.dec.UseNumber()
+
+	v, err := d.value()
+	if err != nil {
+		return nil, d.error(err)
+	}
+	if _, err = d.dec.Token(); err != io.EOF {
+		return nil, d.error(errors.New("unexpected data after the object"))
+	}
+	root, ok := v.(*omap)
+	if !ok {
+		return nil, &FormatError{Line: 1, Msg: errNotObject.Error()}
+	}
+	return treeValues(root)
+}
+
+func (jsonFormat) Encode(values []KeyValue) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	root, err := valuesTree(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// decodeJSONValue decodes JSON into a tree; the order of the keys
+// is kept.
+func decodeJSONValue(data []byte) (interface{}, error) {
+	d := &jsonDecoder{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	d.dec.UseNumber()
+
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = d.dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the value")
+	}
+	return v, nil
+}
+
+// jsonDecoder reads the tokens of a JSON document into a tree.
+type jsonDecoder struct {
+	data []byte
+	dec  *json.Decoder
+}
+
+// line returns the line number of the position of the decoder.
+func (d *jsonDecoder) line() int {
+	off := int(d.dec.InputOffset())
+	if off > len(d.data) {
+		off = len(d.data)
+	}
+	return bytes.Count(d.data[:off], []byte("\n")) + 1
+}
+
+// error returns err as a *FormatError.
+func (d *jsonDecoder) error(err error) error {
+	line := d.line()
+	var serr *json.SyntaxError
+	if errors.As(err, &serr) && int(serr.Offset) <= len(d.data) {
+		line = bytes.Count(d.data[:serr.Offset], []byte("\n")) + 1
+	}
+	return &FormatError{Line: line, Msg: err.Error()}
+}
+
+func (d *jsonDecoder) value() (interface{}, error) {
+	t, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		m := newOmap()
+		for d.dec.More() {
+			kt, err := d.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := kt.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v", kt)
+			}
+			line := d.line()
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := m.vals[key]; dup {
+				return nil, fmt.Errorf("duplicate key %q", key)
+			}
+			m.set(key, v, line)
+		}
+		_, err = d.dec.Token()
+		return m, err
+
+	case json.Delim('['):
+		list := []interface{}{}
+		for d.dec.More() {
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		_, err = d.dec.Token()
+		return list, err
+	}
+
+	return t, nil
+}
@@ -0,0 +1,298 @@
+package webconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stripLines returns the values without their line numbers.
+func stripLines(values []KeyValue) []KeyValue {
+	list := make([]KeyValue, len(values))
+	for i := 0; i < len(values); i++ {
+		list[i] = values[i]
+		list[i].Line = 0
+	}
+	return list
+}
+
+func TestFormatDecode(t *testing.T) {
+	want := []KeyValue{
+		{Key: "maintenance-window", Value: "true"},
+		{Section: "Site", Key: "hostname", Value: "localhost"},
+		{Section: "Site", Key: "alternate-hostnames", Value: "a.com, b.com"},
+		{Section: "Site", Key: "portno", Value: "8085"},
+		{Section: "Data", Key: "hex", Value: "0x1F"},
+		{Section: "Data", Key: "multi", Value: "l1\nl2"},
+		{Section: "Data", Key: "quoted", Value: "a # b"},
+	}
+	tests := []struct {
+		format string
+		in     string
+	}{
+		{"all", "maintenance-window true\nSite\n   hostname localhost\n   alternate-hostnames a.com, b.com\n   portno 8085\n" +
+			"Data\n   hex 0x1F\n   multi <<EOT\nl1\nl2\nEOT\n   quoted a # b\n"},
+		{"yaml", "# comment\nmaintenance-window: true\nSite:\n  hostname: localhost # comment\n  alternate-hostnames:\n    - a.com\n    - 'b.com'\n  portno: 8085\n" +
+			"Data:\n  hex: \"0x1F\"\n  multi: |-\n    l1\n    l2\n  quoted: \"a # b\"\n"},
+		{"yaml", "maintenance-window: true\nSite:\n  hostname: localhost\n  alternate-hostnames: [a.com, b.com]\n  portno: 8085\n" +
+			"Data:\n  hex: 0x1F\n  multi: \"l1\\nl2\"\n  quoted: 'a # b'\n"},
+		{"toml", "# comment\nmaintenance-window = true\n\n[Site]\nhostname = \"localhost\" # comment\nalternate-hostnames = [\"a.com\", 'b.com']\nportno = 8085\n\n" +
+			"[Data]\nhex = \"0x1F\"\nmulti = \"\"\"\nl1\nl2\"\"\"\nquoted = \"a # b\"\n"},
+		{"toml", "maintenance-window = true\nSite.hostname = \"localhost\"\nSite.alternate-hostnames = [\n  \"a.com\",\n  \"b.com\",\n]\nSite.portno = 8085\n" +
+			"[Data]\nhex = '0x1F'\nmulti = \"l1\\nl2\"\nquoted = '''a # b'''\n"},
+		{"json", `{"maintenance-window": true, "Site": {"hostname": "localhost", "alternate-hostnames": ["a.com", "b.com"], "portno": 8085},` +
+			`"Data": {"hex": "0x1F", "multi": "l1\nl2", "quoted": "a # b"}}`},
+	}
+	for _, tt := range tests {
+		f, _ := lookupFormat(tt.format)
+		values, err := f.Decode([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v\n%s", tt.format, err, tt.in)
+			continue
+		}
+		if got := stripLines(values); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v\nwant %+v", tt.format, got, want)
+		}
+	}
+}
+
+func TestFormatDecodeErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		in     string
+		line   int
+	}{
+		{"yaml", "Site:\n  hostname: \"localhost\n", 2},
+		{"yaml", "- a\n- b\n", 1},
+		{"toml", "[Site]\nhostname = localhost\n", 2},
+		{"toml", "[Site\nportno = 1\n", 1},
+		{"toml", "a = 1\na = 2\n", 2},
+		{"json", "[1, 2]", 0},
+		{"json", `{"Site": {"portno": }}`, 0},
+	}
+	for _, tt := range tests {
+		f, _ := lookupFormat(tt.format)
+		_, err := f.Decode([]byte(tt.in))
+		if err == nil {
+			t.Errorf("%s %q: no error", tt.format, tt.in)
+			continue
+		}
+		if fe, ok := err.(*FormatError); ok && tt.line > 0 && fe.Line != tt.line {
+			t.Errorf("%s %q: got line %d; want %d", tt.format, tt.in, fe.Line, tt.line)
+		}
+	}
+}
+
+func TestFormatEncode(t *testing.T) {
+	values := []KeyValue{
+		{Key: "maintenance-window", Value: "on"},
+		{Section: "Site", Key: "portno", Value: "0080"},
+		{Section: "Admin", Key: "portno", Value: "9000"},
+		{Section: "HTTP", Key: "allowed-methods", Value: "GET, POST"},
+		{Section: "Data", Key: "multi", Value: "l1\nl2"},
+		{Section: "Data", Key: "time", Value: "12:30"},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"all", "maintenance-window on\n\nSite\n   portno 0080\n\nAdmin\n   portno 9000\n\nHTTP\n   allowed-methods GET, POST\n\n" +
+			"Data\n   multi <<EOT\nl1\nl2\n   EOT\n   time 12:30\n"},
+		{"yaml", "maintenance-window: true\nSite:\n  portno: \"0080\"\nAdmin:\n  portno: 9000\nHTTP:\n  allowed-methods:\n    - GET\n    - POST\n" +
+			"Data:\n  multi: |-\n    l1\n    l2\n  time: \"12:30\"\n"},
+		{"toml", "maintenance-window = true\n\n[Site]\nportno = \"0080\"\n\n[Admin]\nportno = 9000\n\n[HTTP]\nallowed-methods = [\"GET\", \"POST\"]\n\n" +
+			"[Data]\nmulti = \"\"\"\nl1\nl2\"\"\"\ntime = \"12:30\"\n"},
+		{"json", "{\n  \"maintenance-window\": true,\n  \"Site\": {\n    \"portno\": \"0080\"\n  },\n  \"Admin\": {\n    \"portno\": 9000\n  },\n" +
+			"  \"HTTP\": {\n    \"allowed-methods\": [\n      \"GET\",\n      \"POST\"\n    ]\n  },\n  \"Data\": {\n    \"multi\": \"l1\\nl2\",\n    \"time\": \"12:30\"\n  }\n}\n"},
+	}
+	for _, tt := range tests {
+		f, _ := lookupFormat(tt.format)
+		b, err := f.Encode(values)
+		if err != nil {
+			t.Errorf("%s: %v", tt.format, err)
+			continue
+		}
+		if string(b) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.format, b, tt.want)
+		}
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		section, key, v string
+		want            interface{}
+	}{
+		{"Site", "portno", "8085", json.Number("8085")},
+		{"Site", "portno", "0", json.Number("0")},
+		{"Site", "portno", "-1", json.Number("-1")},
+		{"Site", "portno", "0080", "0080"},
+		{"Site", "portno", "+80", "+80"},
+		{"Site", "portno", "80x", "80x"},
+		{"Site", "portno", "", ""},
+		{"", "maintenance-window", "on", true},
+		{"", "maintenance-window", "no", false},
+		{"", "maintenance-window", "maybe", "maybe"},
+		{"Site", "alternate-hostnames", "a, b", []interface{}{"a", "b"}},
+		{"Data", "portno", "8085", "8085"},
+	}
+	for _, tt := range tests {
+		if got := typedValue(tt.section, tt.key, tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("typedValue(%s.%s, %q) = %#v; want %#v", tt.section, tt.key, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	plain := []string{"localhost", "a b", "/path/x", "10.0.0.0/8", "GET", "x-1", "v1.2", "a:b"}
+	quoted := []string{"", " a", "yes", "2026", "Off", "n", "null", "~", "true", "- a", "a: b", "a #b", "[x]", "'x'",
+		"123", "0123", "0x1F", "0o17", "0b101", "+5", "-5", ".5", "5.", "1_000", "1e3", "12:30", "1:20:30",
+		".inf", "-.Inf", ".NaN", "10.0.0.1", "2026-01-02", "2026-01-02 15:04", "2026-01-02T15:04:05Z"}
+	for _, s := range plain {
+		if got := yamlString(s); got != s {
+			t.Errorf("yamlString(%q) = %s; want it plain", s, got)
+		}
+	}
+	for _, s := range quoted {
+		if got := yamlString(s); got == s || !strings.HasPrefix(got, `"`) {
+			t.Errorf("yamlString(%q) = %s; want it quoted", s, got)
+		}
+	}
+}
+
+// TestConvertRoundTrip converts the default config and the regression
+// of 0080 to each format and back.
+func TestConvertRoundTrip(t *testing.T) {
+	inputs := []string{
+		cfgTemplateAll,
+		"Site\n  portno 0080\n",
+		"Data\n   hex 0x1F\n   octal 0123\n   time 12:30\n   n 1_000\n   empty\n   quote \"a\\\"b\"\n",
+	}
+	for _, in := range inputs {
+		want, err := allFormat{}.Decode([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, to := range []string{"json", "yaml", "toml"} {
+			b, err := Convert([]byte(in), "all", to)
+			if err != nil {
+				t.Errorf("all to %s: %v", to, err)
+				continue
+			}
+			back, err := Convert(b, to, "all")
+			if err != nil {
+				t.Errorf("%s to all: %v\n%s", to, err, b)
+				continue
+			}
+			got, _ := allFormat{}.Decode(back)
+			if !equalValues(got, want) {
+				t.Errorf("all to %s and back:\n%s\ngot  %+v\nwant %+v", to, b, stripLines(got), stripLines(want))
+			}
+		}
+	}
+}
+
+// equalValues tells if the values are the same, as read by the
+// config; i.e. the switch on is the same as true. The keys without a
+// section are written first in the free-style format, so the order
+// is not compared.
+func equalValues(a []KeyValue, b []KeyValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	m := make(map[string]string, len(b))
+	for i := 0; i < len(b); i++ {
+		m[b[i].Section+"."+b[i].Key] = b[i].Value
+	}
+	for i := 0; i < len(a); i++ {
+		x := a[i].Value
+		y, ok := m[a[i].Section+"."+a[i].Key]
+		if !ok {
+			return false
+		}
+		if x == y {
+			continue
+		}
+		bx, okx := parseBool(x)
+		by, oky := parseBool(y)
+		if !(okx && oky && bx == by) && strings.Join(splitList(x), ",") != strings.Join(splitList(y), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzFormatRoundTrip checks that the values of data (in format) are
+// read back the same after they're written in each format; the values
+// of Data (strings) exactly, the others once they're typed.
+func fuzzFormatRoundTrip(t *testing.T, format string, data []byte) {
+	f, _ := lookupFormat(format)
+	values, err := f.Decode(data)
+	if err != nil {
+		return
+	}
+	for _, name := range []string{"all", "json", "yaml", "toml"} {
+		to, _ := lookupFormat(name)
+		b, err := to.Encode(values)
+		if err != nil {
+			continue
+		}
+		v2, err := to.Decode(b)
+		if err != nil {
+			t.Fatalf("%s from %s: %v\n%s", name, format, err, b)
+		}
+		b2, err := to.Encode(v2)
+		if err != nil {
+			t.Fatalf("%s from %s: %v", name, format, err)
+		}
+		v3, err := to.Decode(b2)
+		if err != nil {
+			t.Fatalf("%s from %s: %v\n%s", name, format, err, b2)
+		}
+		if !reflect.DeepEqual(stripLines(v2), stripLines(v3)) {
+			t.Fatalf("%s from %s is not stable:\n%s\n%s", name, format, b, b2)
+		}
+		want, got := dataValues(values), dataValues(v2)
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("%s from %s: Data %s is %q; want %q\n%s", name, format, k, got[k], v, b)
+			}
+		}
+	}
+}
+
+// dataValues returns the values of the Data section by key.
+func dataValues(values []KeyValue) map[string]string {
+	m := make(map[string]string)
+	for i := 0; i < len(values); i++ {
+		if values[i].Section == dataSection && values[i].Key != "" {
+			m[values[i].Key] = values[i].Value
+		}
+	}
+	return m
+}
+
+func FuzzYAMLDecode(f *testing.F) {
+	f.Add([]byte("maintenance-window: true\nSite:\n  portno: 8085\n  alternate-hostnames: [a, b]\nData:\n  k: |-\n    l1\n    l2\n"))
+	f.Add([]byte("Data:\n  a: \"0x1F\"\n  b: 'it''s'\n  c: >\n    folded\n    text\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzFormatRoundTrip(t, "yaml", data)
+	})
+}
+
+func FuzzTOMLDecode(f *testing.F) {
+	f.Add([]byte("maintenance-window = true\n[Site]\nportno = 8085\nalternate-hostnames = [\"a\", \"b\"]\n[Data]\nk = \"\"\"\nl1\nl2\"\"\"\n"))
+	f.Add([]byte("Site.hostname = 'x'\n[Data]\na = '''raw\\n'''\nb = \"\\u00e9\"\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzFormatRoundTrip(t, "toml", data)
+	})
+}
+
+func FuzzConvert(f *testing.F) {
+	f.Add([]byte(cfgTemplateAll))
+	f.Add([]byte("Site\n  portno 0080\nData\n   hex 0x1F\n   multi <<EOT\na\nb\nEOT\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzFormatRoundTrip(t, "all", data)
+	})
+}
@@ -0,0 +1,668 @@
+package webconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tomlFormat reads and writes the config as TOML; the sections are
+// tables. i.e.
+//
+//	maintenance-window = false
+//
+//	[Site]
+//	hostname = "localhost"
+//	portno = 8085
+//	alternate-hostnames = ["mydomain.com"]
+//
+// Dates and times are read as strings.
+type tomlFormat struct{}
+
+func (tomlFormat) Extensions() []string {
+	return []string{".toml"}
+}
+
+func (tomlFormat) Decode(data []byte) ([]KeyValue, error) {
+	if err := checkUTF8(data); err != nil {
+		return nil, err
+	}
+	p := &tomlParser{s: strings.ReplaceAll(string(data), "\r\n", "\n"), line: 1, root: newOmap()}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return treeValues(p.root)
+}
+
+// Encode writes the keys without a section first; then a table for
+// each section. The lists of objects (conditional-http-service) are
+// arrays of tables.
+func (tomlFormat) Encode(values []KeyValue) ([]byte, error) {
+	root, err := valuesTree(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for i := 0; i < len(root.keys); i++ {
+		k := root.keys[i]
+		if _, ok := root.vals[k].(*omap); ok {
+			continue
+		}
+		if err := writeTOMLKey(&b, k, root.vals[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < len(root.keys); i++ {
+		sec, ok := root.vals[root.keys[i]].(*omap)
+		if !ok {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		name := tomlKey(root.keys[i])
+		b.WriteString("[" + name + "]\n")
+
+		var tables []string
+		for j := 0; j < len(sec.keys); j++ {
+			k := sec.keys[j]
+			if isTableArray(sec.vals[k]) {
+				tables = append(tables, k)
+				continue
+			}
+			if err := writeTOMLKey(&b, k, sec.vals[k]); err != nil {
+				return nil, err
+			}
+		}
+		for j := 0; j < len(tables); j++ {
+			list := sec.vals[tables[j]].([]interface{})
+			for n := 0; n < len(list); n++ {
+				m := list[n].(*omap)
+				b.WriteString("\n[[" + name + "." + tomlKey(tables[j]) + "]]\n")
+				for x := 0; x < len(m.keys); x++ {
+					if err := writeTOMLKey(&b, m.keys[x], m.vals[m.keys[x]]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// isTableArray tells if v is a (non-empty) list of objects.
+func isTableArray(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for i := 0; i < len(list); i++ {
+		if _, ok := list[i].(*omap); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func writeTOMLKey(b *bytes.Buffer, key string, v interface{}) error {
+	s, err := tomlValue(v)
+	if err != nil {
+		return err
+	}
+	b.WriteString(tomlKey(key) + " = " + s + "\n")
+	return nil
+}
+
+// tomlValue returns the TOML text of v; the objects are inline
+// tables.
+func tomlValue(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return `""`, nil
+	case string:
+		return tomlString(x), nil
+	case json.Number:
+		return x.String(), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case []interface{}:
+		list := make([]string, len(x))
+		for i := 0; i < len(x); i++ {
+			s, err := tomlValue(x[i])
+			if err != nil {
+				return "", err
+			}
+			list[i] = s
+		}
+		return "[" + strings.Join(list, ", ") + "]", nil
+	case *omap:
+		list := make([]string, len(x.keys))
+		for i := 0; i < len(x.keys); i++ {
+			s, err := tomlValue(x.vals[x.keys[i]])
+			if err != nil {
+				return "", err
+			}
+			list[i] = tomlKey(x.keys[i]) + " = " + s
+		}
+		return "{ " + strings.Join(list, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// tomlKey returns key as a bare key, or quoted.
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isTOMLBareChar(key[i]) {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+func isTOMLBareChar(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '-'
+}
+
+// tomlString returns s as a basic string; a multi-line string if it
+// has line breaks.
+func tomlString(s string) string {
+	multiline := strings.Contains(s, "\n") && !strings.Contains(s, `"""`) && !strings.HasSuffix(s, `"`)
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"' && !multiline:
+			b.WriteString(`\"`)
+		case r == '\n' && multiline:
+			b.WriteByte('\n')
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteByte('\t')
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		return `"""` + "\n" + b.String() + `"""`
+	}
+	return `"` + b.String() + `"`
+}
+
+// tomlParser reads TOML; pos is the position in s and line its line
+// number. cur is the table that the keys are added to.
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+	root *omap
+	cur  *omap
+}
+
+func (p *tomlParser) errorf(format string, a ...interface{}) error {
+	return &FormatError{Line: p.line, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *tomlParser) advance() {
+	if p.s[p.pos] == '\n' {
+		p.line++
+	}
+	p.pos++
+}
+
+// skipSpace skips spaces and tabs; and line breaks and comments if
+// lines is set.
+func (p *tomlParser) skipSpace(lines bool) {
+	for !p.eof() {
+		switch ch := p.peek(); {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			p.advance()
+		case ch == '\n' && lines:
+			p.advance()
+		case ch == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine reads the rest of a line after a key/value or a table
+// header; only a comment can follow.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q at the end of the line", p.s[p.pos:p.lineEnd()])
+	}
+	p.advance()
+	return nil
+}
+
+func (p *tomlParser) lineEnd() int {
+	if i := strings.IndexByte(p.s[p.pos:], '\n'); i > -1 {
+		return p.pos + i
+	}
+	return len(p.s)
+}
+
+func (p *tomlParser) parse() error {
+	p.cur = p.root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+
+		if p.peek() == '[' {
+			if err := p.table(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		line := p.line
+		path, err := p.key()
+		if err != nil {
+			return err
+		}
+		p.skipSpace(false)
+		if p.peek() != '=' {
+			return p.errorf("expected = after the key")
+		}
+		p.advance()
+		p.skipSpace(false)
+		v, err := p.value()
+		if err != nil {
+			return err
+		}
+		m, err := p.subtable(p.cur, path[:len(path)-1], line)
+		if err != nil {
+			return err
+		}
+		k := path[len(path)-1]
+		if _, dup := m.vals[k]; dup {
+			return &FormatError{Line: line, Msg: fmt.Sprintf("duplicate key %q", k)}
+		}
+		m.set(k, v, line)
+
+		if err = p.endOfLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// table reads a [table] or [[array of tables]] header.
+func (p *tomlParser) table() error {
+	line := p.line
+	p.advance()
+	array := p.peek() == '['
+	if array {
+		p.advance()
+	}
+
+	p.skipSpace(false)
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	end := "]"
+	if array {
+		end = "]]"
+	}
+	if !strings.HasPrefix(p.s[p.pos:], end) {
+		return p.errorf("%s is missing", end)
+	}
+	p.pos += len(end)
+
+	parent, err := p.subtable(p.root, path[:len(path)-1], line)
+	if err != nil {
+		return err
+	}
+	k := path[len(path)-1]
+
+	if array {
+		list, _ := parent.vals[k].([]interface{})
+		if _, ok := parent.vals[k]; ok && list == nil {
+			return &FormatError{Line: line, Msg: fmt.Sprintf("%s is not an array of tables", strings.Join(path, "."))}
+		}
+		m := newOmap()
+		parent.set(k, append(list, m), line)
+		p.cur = m
+	} else {
+		m, err := p.subtable(parent, path[len(path)-1:], line)
+		if err != nil {
+			return err
+		}
+		p.cur = m
+	}
+
+	return p.endOfLine()
+}
+
+// subtable returns the table at path in m; the tables are created if
+// they do not exist. The last table of an array of tables is used.
+func (p *tomlParser) subtable(m *omap, path []string, line int) (*omap, error) {
+	for i := 0; i < len(path); i++ {
+		v, ok := m.vals[path[i]]
+		if !ok {
+			t := newOmap()
+			m.set(path[i], t, line)
+			m = t
+			continue
+		}
+		switch x := v.(type) {
+		case *omap:
+			m = x
+		case []interface{}:
+			t, ok := x[len(x)-1].(*omap)
+			if len(x) == 0 || !ok {
+				return nil, &FormatError{Line: line, Msg: fmt.Sprintf("%s is not a table", path[i])}
+			}
+			m = t
+		default:
+			return nil, &FormatError{Line: line, Msg: fmt.Sprintf("%s is not a table", path[i])}
+		}
+	}
+	return m, nil
+}
+
+// key reads a (dotted) key.
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace(false)
+		var k string
+		switch p.peek() {
+		case '"', '\'':
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			k = v.(string)
+		default:
+			start := p.pos
+			for !p.eof() && isTOMLBareChar(p.peek()) {
+				p.advance()
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected a key")
+			}
+			k = p.s[start:p.pos]
+		}
+		path = append(path, k)
+
+		p.skipSpace(false)
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.advance()
+	}
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	switch {
+	case strings.HasPrefix(p.s[p.pos:], `"""`):
+		return p.multilineString(`"""`)
+	case strings.HasPrefix(p.s[p.pos:], `'''`):
+		return p.multilineString(`'''`)
+	}
+
+	switch p.peek() {
+	case '"':
+		end := p.pos + 1
+		for end < len(p.s) && p.s[end] != '"' && p.s[end] != '\n' {
+			if p.s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.s) || p.s[end] != '"' {
+			return nil, p.errorf("the string is not closed")
+		}
+		s, err := unescapeTOML(p.s[p.pos+1 : end])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos = end + 1
+		return s, nil
+
+	case '\'':
+		end := strings.IndexAny(p.s[p.pos+1:], "'\n")
+		if end < 0 || p.s[p.pos+1+end] != '\'' {
+			return nil, p.errorf("the string is not closed")
+		}
+		s := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return s, nil
+
+	case '[':
+		p.advance()
+		list := []interface{}{}
+		for {
+			p.skipSpace(true)
+			if p.peek() == ']' {
+				p.advance()
+				return list, nil
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.skipSpace(true)
+			switch p.peek() {
+			case ',':
+				p.advance()
+			case ']':
+			default:
+				return nil, p.errorf("expected , or ] in the array")
+			}
+		}
+
+	case '{':
+		p.advance()
+		m := newOmap()
+		for {
+			p.skipSpace(false)
+			if p.peek() == '}' {
+				p.advance()
+				return m, nil
+			}
+			line := p.line
+			path, err := p.key()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.peek() != '=' {
+				return nil, p.errorf("expected = after the key")
+			}
+			p.advance()
+			p.skipSpace(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			t, err := p.subtable(m, path[:len(path)-1], line)
+			if err != nil {
+				return nil, err
+			}
+			t.set(path[len(path)-1], v, line)
+			p.skipSpace(false)
+			switch p.peek() {
+			case ',':
+				p.advance()
+			case '}':
+			default:
+				return nil, p.errorf("expected , or } in the inline table")
+			}
+		}
+	}
+
+	// numbers, booleans, dates and times
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\n#,]}", p.peek()) < 0 {
+		p.advance()
+	}
+	// a date and a time can be separated by a space.
+	if t := p.s[start:p.pos]; len(t) == 10 && t[4] == '-' && p.peek() == ' ' && p.pos+1 < len(p.s) && p.s[p.pos+1] >= '0' && p.s[p.pos+1] <= '9' {
+		p.advance()
+		for !p.eof() && strings.IndexByte(" \t\n#,]}", p.peek()) < 0 {
+			p.advance()
+		}
+	}
+	t := p.s[start:p.pos]
+
+	switch t {
+	case "":
+		return nil, p.errorf("expected a value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n := strings.ReplaceAll(t, "_", ""); isJSONNumber(strings.TrimPrefix(n, "+")) {
+		return json.Number(strings.TrimPrefix(n, "+")), nil
+	}
+	if t[0] >= '0' && t[0] <= '9' || t[0] == '+' || t[0] == '-' || t == "inf" || t == "nan" {
+		// dates, times, hex/octal/binary numbers
+		return t, nil
+	}
+	return nil, p.errorf("invalid value %q; strings must be quoted", t)
+}
+
+// multilineString reads a multi-line string quoted by q; a line
+// break right after the opening quotes is left out.
+func (p *tomlParser) multilineString(q string) (interface{}, error) {
+	start := p.pos + 3
+	end := strings.Index(p.s[start:], q)
+	if end < 0 {
+		return nil, p.errorf("the string is not closed")
+	}
+	end += start
+	// up to two quotes can be right before the closing ones.
+	for end+3 < len(p.s) && p.s[end+3] == q[0] {
+		end++
+	}
+
+	s := p.s[start:end]
+	for p.pos < end+3 {
+		p.advance()
+	}
+	s = strings.TrimPrefix(s, "\n")
+
+	if q == `'''` {
+		return s, nil
+	}
+
+	// A \ at the end of a line trims the line break and the white
+	// space that follows.
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "\\")
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		rest := strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(rest, "\n") {
+			s = strings.TrimLeft(rest, " \t\n")
+			continue
+		}
+		if i+1 < len(s) {
+			b.WriteString(s[i : i+2])
+			s = s[i+2:]
+		} else {
+			b.WriteString(s[i:])
+			s = ""
+		}
+	}
+
+	v, err := unescapeTOML(b.String())
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// unescapeTOML decodes the escapes of a basic string.
+func unescapeTOML(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			return "", fmt.Errorf("invalid escape at the end of %q", s)
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case '"', '\\':
+			b.WriteByte(s[i])
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape in %q", s)
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in %q", s[i], s)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,657 @@
+package webconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlFormat reads and writes the config as YAML; i.e.
+//
+//	maintenance-window: false
+//	Site:
+//	  hostname: localhost
+//	  portno: 8085
+//	  alternate-hostnames:
+//	    - mydomain.com
+//
+// The block style (mappings, sequences, and literal | and folded >
+// scalars), flow sequences and mappings, and plain and quoted scalars
+// are supported; anchors, tags and multiple documents are not.
+type yamlFormat struct{}
+
+func (yamlFormat) Extensions() []string {
+	return []string{".yaml", ".yml"}
+}
+
+func (yamlFormat) Decode(data []byte) ([]KeyValue, error) {
+	if err := checkUTF8(data); err != nil {
+		return nil, err
+	}
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+
+	if !p.skip() {
+		return nil, nil
+	}
+	v, err := p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skip() {
+		return nil, p.errorf("unexpected indentation")
+	}
+	root, ok := v.(*omap)
+	if !ok {
+		return nil, &FormatError{Line: 1, Msg: errNotObject.Error()}
+	}
+	return treeValues(root)
+}
+
+func (yamlFormat) Encode(values []KeyValue) ([]byte, error) {
+	root, err := valuesTree(values)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := writeYAMLMap(&b, root, ""); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// yamlParser reads YAML by lines; i is the current line.
+type yamlParser struct {
+	lines []string
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, a ...interface{}) error {
+	return &FormatError{Line: p.i + 1, Msg: fmt.Sprintf(format, a...)}
+}
+
+// skip moves to the next line with content; false at the end of the
+// document.
+func (p *yamlParser) skip() bool {
+	for ; p.i < len(p.lines); p.i++ {
+		t := strings.TrimSpace(stripYAMLComment(p.lines[p.i]))
+		if t == "..." {
+			p.i = len(p.lines)
+			return false
+		}
+		if t != "" && t != "---" {
+			return true
+		}
+	}
+	return false
+}
+
+// indent returns the indentation and the content of the current
+// line.
+func (p *yamlParser) indent() (int, string) {
+	l := p.lines[p.i]
+	t := strings.TrimLeft(l, " ")
+	return len(l) - len(t), strings.TrimRight(stripYAMLComment(t), " \t")
+}
+
+// node reads the node at the current line, which is indented by
+// indent.
+func (p *yamlParser) node(indent int) (interface{}, error) {
+	n, t := p.indent()
+	if strings.HasPrefix(t, "\t") {
+		return nil, p.errorf("tabs cannot be used for indentation")
+	}
+	switch {
+	case t == "-" || strings.HasPrefix(t, "- "):
+		return p.sequence(n)
+	case yamlKeyEnd(t) > -1:
+		return p.mapping(n)
+	}
+	p.i++
+	return yamlValue(t, p.i)
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := newOmap()
+	for p.skip() {
+		n, t := p.indent()
+		if n < indent {
+			break
+		}
+		if n > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		j := yamlKeyEnd(t)
+		if j < 0 {
+			return nil, p.errorf("expected a key: value")
+		}
+		key, err := yamlKey(t[:j])
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, dup := m.vals[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		line := p.i + 1
+		rest := strings.TrimSpace(t[j+1:])
+		p.i++
+
+		var v interface{}
+		switch {
+		case rest == "":
+			if p.skip() {
+				nn, nt := p.indent()
+				if nn > indent || nn == indent && (nt == "-" || strings.HasPrefix(nt, "- ")) {
+					if v, err = p.node(nn); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			v, err = p.blockScalar(indent, rest)
+		case rest[0] == '[' || rest[0] == '{':
+			v, err = p.flow(rest, line)
+		default:
+			v, err = yamlValue(rest, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.set(key, v, line)
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for p.skip() {
+		n, t := p.indent()
+		if n < indent || !(t == "-" || strings.HasPrefix(t, "- ")) {
+			break
+		}
+		if n > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+
+		item := strings.TrimLeft(t[1:], " ")
+		if item == "" {
+			p.i++
+			var v interface{}
+			if p.skip() {
+				if nn, _ := p.indent(); nn > indent {
+					var err error
+					if v, err = p.node(nn); err != nil {
+						return nil, err
+					}
+				}
+			}
+			list = append(list, v)
+			continue
+		}
+
+		// The item is read as if it were on a line of its own.
+		n += len(t) - len(item)
+		p.lines[p.i] = strings.Repeat(" ", n) + item
+
+		var v interface{}
+		var err error
+		switch {
+		case item[0] == '|' || item[0] == '>':
+			p.i++
+			v, err = p.blockScalar(indent, item)
+		case item[0] == '[' || item[0] == '{':
+			p.i++
+			v, err = p.flow(item, p.i)
+		default:
+			v, err = p.node(n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// blockScalar reads the lines of a literal (|) or folded (>) scalar;
+// the lines are indented more than indent.
+func (p *yamlParser) blockScalar(indent int, header string) (interface{}, error) {
+	folded := header[0] == '>'
+	chomp := strings.TrimSpace(header[1:])
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, &FormatError{Line: p.i, Msg: fmt.Sprintf("unsupported block scalar header %q", header)}
+	}
+
+	var lines []string
+	content := -1
+	for ; p.i < len(p.lines); p.i++ {
+		l := p.lines[p.i]
+		t := strings.TrimLeft(l, " ")
+		if t == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(l) - len(t)
+		if content < 0 {
+			content = n
+		}
+		if n <= indent || n < content {
+			break
+		}
+		lines = append(lines, l[content:])
+	}
+
+	// The trailing blank lines are subject to chomping.
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing++
+	}
+	lines = lines[:len(lines)-trailing]
+
+	var s string
+	if folded {
+		var b strings.Builder
+		for i := 0; i < len(lines); i++ {
+			switch {
+			case i == 0:
+			case lines[i] == "" || lines[i-1] == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(lines[i])
+		}
+		s = b.String()
+	} else {
+		s = strings.Join(lines, "\n")
+	}
+
+	switch {
+	case chomp == "-" || len(lines) == 0:
+	case chomp == "+":
+		s += strings.Repeat("\n", trailing+1)
+	default:
+		s += "\n"
+	}
+	return s, nil
+}
+
+// flow reads a flow sequence or mapping; it can continue on the
+// next lines.
+func (p *yamlParser) flow(s string, line int) (interface{}, error) {
+	for !flowClosed(s) && p.i < len(p.lines) {
+		s += " " + strings.TrimSpace(stripYAMLComment(p.lines[p.i]))
+		p.i++
+	}
+	f := &flowParser{s: s, line: line}
+	v, err := f.value()
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpace(); f.pos < len(f.s) {
+		return nil, &FormatError{Line: line, Msg: "unexpected text after " + s[:f.pos]}
+	}
+	return v, nil
+}
+
+// flowClosed tells if the brackets of s are balanced.
+func flowClosed(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// flowParser reads a flow collection; i.e. [a, b] or {k: v}.
+type flowParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (f *flowParser) errorf(format string, a ...interface{}) error {
+	return &FormatError{Line: f.line, Msg: fmt.Sprintf(format, a...)}
+}
+
+func (f *flowParser) skipSpace() {
+	for f.pos < len(f.s) && (f.s[f.pos] == ' ' || f.s[f.pos] == '\t') {
+		f.pos++
+	}
+}
+
+func (f *flowParser) value() (interface{}, error) {
+	f.skipSpace()
+	if f.pos >= len(f.s) {
+		return nil, f.errorf("unexpected end of %s", f.s)
+	}
+
+	switch f.s[f.pos] {
+	case '[':
+		f.pos++
+		list := []interface{}{}
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == ']' {
+				f.pos++
+				return list, nil
+			}
+			v, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err = f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '{':
+		f.pos++
+		m := newOmap()
+		for {
+			f.skipSpace()
+			if f.pos < len(f.s) && f.s[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+			k, err := f.scalar(":,}")
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key, _ = flatValue(k)
+			}
+			f.skipSpace()
+			var v interface{}
+			if f.pos < len(f.s) && f.s[f.pos] == ':' {
+				f.pos++
+				if v, err = f.value(); err != nil {
+					return nil, err
+				}
+			}
+			m.set(key, v, f.line)
+			if err = f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return f.scalar(",]}")
+}
+
+// separator reads the , between the items or the closing bracket.
+func (f *flowParser) separator(end byte) error {
+	f.skipSpace()
+	if f.pos >= len(f.s) {
+		return f.errorf("%c is missing", end)
+	}
+	switch f.s[f.pos] {
+	case ',':
+		f.pos++
+		return nil
+	case end:
+		return nil
+	}
+	return f.errorf("expected , or %c in %s", end, f.s)
+}
+
+// scalar reads a quoted scalar or a plain one up to one of stop.
+func (f *flowParser) scalar(stop string) (interface{}, error) {
+	f.skipSpace()
+	start := f.pos
+	if f.pos < len(f.s) && (f.s[f.pos] == '"' || f.s[f.pos] == '\'') {
+		q := f.s[f.pos]
+		for f.pos++; f.pos < len(f.s); f.pos++ {
+			if f.s[f.pos] == '\\' && q == '"' {
+				f.pos++
+				continue
+			}
+			if f.s[f.pos] == q {
+				if q == '\'' && f.pos+1 < len(f.s) && f.s[f.pos+1] == '\'' {
+					f.pos++
+					continue
+				}
+				f.pos++
+				return yamlValue(f.s[start:f.pos], f.line)
+			}
+		}
+		return nil, f.errorf("the quoted string is not closed")
+	}
+
+	for f.pos < len(f.s) && !strings.ContainsRune(stop, rune(f.s[f.pos])) {
+		// a : in a plain scalar (i.e. a url) is not a separator.
+		if f.s[f.pos] == ':' && f.pos+1 < len(f.s) && f.s[f.pos+1] != ' ' {
+			f.pos++
+			continue
+		}
+		f.pos++
+	}
+	return yamlValue(strings.TrimSpace(f.s[start:f.pos]), f.line)
+}
+
+// yamlValue returns the value of a scalar; a plain scalar is a
+// number, a boolean (true/false), null (null, ~ or blank) or a string.
+func yamlValue(s string, line int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+			return nil, &FormatError{Line: line, Msg: "the quoted string is not closed"}
+		}
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, &FormatError{Line: line, Msg: fmt.Sprintf("invalid quoted string %s", s)}
+		}
+		return v, nil
+
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, &FormatError{Line: line, Msg: "the quoted string is not closed"}
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if isJSONNumber(s) {
+		return json.Number(s), nil
+	}
+	return s, nil
+}
+
+// yamlKey returns the (unquoted) key.
+func yamlKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		v, err := yamlValue(s, 0)
+		if err != nil {
+			return "", fmt.Errorf("invalid key %s", s)
+		}
+		s, _ = v.(string)
+	}
+	if s == "" {
+		return "", fmt.Errorf("the key is blank")
+	}
+	return s, nil
+}
+
+// yamlKeyEnd returns the index of the : that ends the key of a
+// line; -1 if it's not a key: value.
+func yamlKeyEnd(t string) int {
+	if t == "" || t[0] == '[' || t[0] == '{' || t[0] == '-' && (len(t) == 1 || t[1] == ' ') {
+		return -1
+	}
+	var quote byte
+	for i := 0; i < len(t); i++ {
+		ch := t[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case i == 0 && (ch == '"' || ch == '\''):
+			quote = ch
+		case ch == ':' && (i+1 == len(t) || t[i+1] == ' ' || t[i+1] == '\t'):
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a comment (# after a space, outside of
+// quotes) from the end of a line.
+func stripYAMLComment(l string) string {
+	var quote byte
+	for i := 0; i < len(l); i++ {
+		ch := l[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			if i == 0 || strings.ContainsRune(" \t[{,:-", rune(l[i-1])) {
+				quote = ch
+			}
+		case ch == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return l[:i]
+		}
+	}
+	return l
+}
+
+func isJSONNumber(s string) bool {
+	if s == "" || !(s[0] == '-' || s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+// writeYAMLMap writes the keys of m indented by indent.
+func writeYAMLMap(b *bytes.Buffer, m *omap, indent string) error {
+	for i := 0; i < len(m.keys); i++ {
+		k := m.keys[i]
+		b.WriteString(indent + yamlString(k) + ":")
+		if err := writeYAMLValue(b, m.vals[k], indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeYAMLValue writes v after a key or a - ; nested values are
+// indented more than indent.
+func writeYAMLValue(b *bytes.Buffer, v interface{}, indent string) error {
+	switch x := v.(type) {
+	case *omap:
+		if len(x.keys) == 0 {
+			b.WriteString(" {}\n")
+			return nil
+		}
+		b.WriteString("\n")
+		return writeYAMLMap(b, x, indent+"  ")
+
+	case []interface{}:
+		if len(x) == 0 {
+			b.WriteString(" []\n")
+			return nil
+		}
+		b.WriteString("\n")
+		for i := 0; i < len(x); i++ {
+			if m, ok := x[i].(*omap); ok && len(m.keys) > 0 {
+				// The first key goes on the line of the -.
+				var sub bytes.Buffer
+				if err := writeYAMLMap(&sub, m, indent+"    "); err != nil {
+					return err
+				}
+				b.WriteString(indent + "  - " + strings.TrimLeft(sub.String(), " "))
+				continue
+			}
+			b.WriteString(indent + "  -")
+			if err := writeYAMLValue(b, x[i], indent+"  "); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case string:
+		if strings.Contains(x, "\n") && !strings.HasSuffix(x, "\n") && !hasControl(strings.ReplaceAll(x, "\n", "")) &&
+			!strings.HasPrefix(x, " ") && !strings.Contains(x, " \n") && !strings.HasSuffix(x, " ") {
+			b.WriteString(" |-\n")
+			lines := strings.Split(x, "\n")
+			for i := 0; i < len(lines); i++ {
+				if lines[i] != "" {
+					b.WriteString(indent + "  " + lines[i])
+				}
+				b.WriteString("\n")
+			}
+			return nil
+		}
+		b.WriteString(" " + yamlString(x) + "\n")
+		return nil
+	}
+
+	s, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	b.WriteString(" " + string(s) + "\n")
+	return nil
+}
+
+// yamlNumber matches the plain scalars that YAML 1.1 or 1.2 may
+// resolve as a number (0123, 0x1F, 0o17, 0b101, +5, .5, 1_000, 1e3,
+// the base-60 12:30, .inf, .nan) or a timestamp (2006-01-02 15:04);
+// more than that, as a string that is quoted is read back as it is.
+var yamlNumber = regexp.MustCompile(`^(?:[-+]?\.?[0-9][0-9a-zA-Z_.:+-]*|[-+]?\.(?:inf|Inf|INF)|\.(?:nan|NaN|NAN)|[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}[Tt ].*)$`)
+
+// yamlString returns s as a plain scalar; or quoted if it would not
+// be read back as the same string, by this package or by other YAML
+// parsers (i.e. 0x1F as 31).
+func yamlString(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || hasControl(s) || yamlNumber.MatchString(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		b, _ := marshalJSON(s)
+		return string(b)
+	}
+	if v, _ := yamlValue(s, 0); v != s {
+		b, _ := marshalJSON(s)
+		return string(b)
+	}
+	switch strings.ToLower(s) {
+	case "yes", "no", "on", "off", "y", "n":
+		// booleans in YAML 1.1
+		b, _ := marshalJSON(s)
+		return string(b)
+	}
+	return s
+}
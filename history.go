@@ -0,0 +1,230 @@
+package webconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultHistoryLimit is the number of versions that are kept;
+// see WithHistoryLimit.
+const defaultHistoryLimit = 100
+
+// Version describes a version of the config file in the history
+// (/appdata/.cfg/history); a version is saved on each change made by
+// Update (and Set, Delete, ... Rollback).
+type Version struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+
+	// Author is set by Tx.SetAuthor; blank if the file was changed
+	// outside of webconfig (i.e. in an editor).
+	Author string `json:"author"`
+
+	// Message describes the change, if it's not an Update; i.e.
+	// "rollback to version 3".
+	Message string `json:"message,omitempty"`
+
+	// Diff is the unified diff from the file before the change.
+	Diff string `json:"diff"`
+}
+
+// Versions returns the versions in the history; the oldest first.
+func (c *Config) Versions() ([]Version, error) {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	return c.versions()
+}
+
+// DiffVersions returns the unified diff of the config file from
+// version from to version to.
+func (c *Config) DiffVersions(from int, to int) (string, error) {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	a, err := c.versionContent(from)
+	if err != nil {
+		return "", err
+	}
+	b, err := c.versionContent(to)
+	if err != nil {
+		return "", err
+	}
+
+	return diffLines(fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", to), a, b), nil
+}
+
+// Rollback restores the config file of version and reloads the
+// config; it's saved as a new version. The file is validated as in
+// Update: nothing is written if the version has errors that the
+// current file does not have.
+func (c *Config) Rollback(version int) error {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	unlock, err := c.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	nb, err := c.versionContent(version)
+	if err != nil {
+		return err
+	}
+	b, err := ReadFile(c.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b, nb) {
+		return nil
+	}
+
+	if errs := newErrors(c.check(b), c.check(nb)); len(errs) > 0 {
+		return &ValidationError{Diagnostics: errs}
+	}
+
+	if err = c.writeConfigFile(nb); err != nil {
+		return err
+	}
+	c.saveVersion(b, nb, "", fmt.Sprintf("rollback to version %d", version))
+
+	// Refresh
+	return c.loadWrittenE(b)
+}
+
+// historyPath returns the directory of the history.
+func (c *Config) historyPath() string {
+	return fmt.Sprintf("%s/.cfg/history", c.AppDataPath)
+}
+
+// versionFilePath returns the path of a file of version; ext is
+// .all for the content and .json for the Version.
+func (c *Config) versionFilePath(version int, ext string) string {
+	return filepath.Join(c.historyPath(), fmt.Sprintf("%06d%s", version, ext))
+}
+
+// versions reads the history; the caller must hold rt.mu.
+func (c *Config) versions() ([]Version, error) {
+	names, err := filepath.Glob(filepath.Join(c.historyPath(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Version, 0, len(names))
+	for i := 0; i < len(names); i++ {
+		b, err := os.ReadFile(names[i])
+		if err != nil {
+			return nil, err
+		}
+		var v Version
+		if err = json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %w", names[i], err)
+		}
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+
+	return list, nil
+}
+
+// versionContent returns the config file of version.
+func (c *Config) versionContent(version int) ([]byte, error) {
+	b, err := os.ReadFile(c.versionFilePath(version, ".all"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("version %d is not in the history", version)
+	}
+	return b, err
+}
+
+// saveVersion adds the change of the config file from b to nb to
+// the history; the caller must hold rt.mu. If b is not the last
+// version (the file was changed outside of webconfig), it's saved
+// first. Errors are reported (see WithErrorHandler), as the change
+// itself has already been made. Nothing is saved if the history is
+// turned off; see WithHistoryLimit.
+func (c *Config) saveVersion(b []byte, nb []byte, author string, msg string) {
+	if c.state().historyLimit == 0 {
+		return
+	}
+	if err := c.addVersions(b, nb, author, msg); err != nil {
+		c.reportError(fmt.Errorf("history: %w", err))
+	}
+}
+
+func (c *Config) addVersions(b []byte, nb []byte, author string, msg string) error {
+	if err := os.MkdirAll(c.historyPath(), os.ModePerm); err != nil {
+		return err
+	}
+	list, err := c.versions()
+	if err != nil {
+		return err
+	}
+
+	last := 0
+	var lastContent []byte
+	if len(list) > 0 {
+		last = list[len(list)-1].Version
+		if lastContent, err = c.versionContent(last); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if last == 0 || !bytes.Equal(lastContent, b) {
+		v := Version{Version: last + 1, Time: now, Message: "changed outside of webconfig"}
+		if last == 0 {
+			v.Message = "initial version"
+		}
+		v.Diff = diffLines(fmt.Sprintf("version %d", last), fmt.Sprintf("version %d", v.Version), lastContent, b)
+		if err = c.writeVersion(v, b); err != nil {
+			return err
+		}
+		last = v.Version
+		list = append(list, v)
+	}
+
+	v := Version{Version: last + 1, Time: now, Author: author, Message: msg}
+	v.Diff = diffLines(fmt.Sprintf("version %d", last), fmt.Sprintf("version %d", v.Version), b, nb)
+	if err = c.writeVersion(v, nb); err != nil {
+		return err
+	}
+	list = append(list, v)
+
+	// Remove the oldest versions.
+	limit := c.state().historyLimit
+	for i := 0; limit > 0 && i < len(list)-limit; i++ {
+		os.Remove(c.versionFilePath(list[i].Version, ".json"))
+		os.Remove(c.versionFilePath(list[i].Version, ".all"))
+	}
+
+	return nil
+}
+
+// writeVersion writes the content and the description of a version.
+func (c *Config) writeVersion(v Version, content []byte) error {
+	if err := os.WriteFile(c.versionFilePath(v.Version, ".all"), content, 0644); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.versionFilePath(v.Version, ".json"), b, 0644)
+}
@@ -0,0 +1,114 @@
+package webconfig
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	c := newTestConfig(t)
+
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Update(func(tx *Tx) error {
+		tx.SetAuthor("admin")
+		return tx.Set("Site", "hostname", "example.com")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := c.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("got %d versions; want 3", len(list))
+	}
+	if list[0].Message != "initial version" || list[2].Author != "admin" {
+		t.Fatalf("got %+v", list)
+	}
+	if !strings.Contains(list[1].Diff, "+\tportno           9000") {
+		t.Fatalf("version 2 diff:\n%s", list[1].Diff)
+	}
+
+	d, err := c.DiffVersions(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(d, "portno           9000") || !strings.Contains(d, "hostname         example.com") {
+		t.Fatalf("diff:\n%s", d)
+	}
+
+	if err := c.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Snapshot(); s.Site.PortNo != 8085 || s.Site.HostName != "localhost" {
+		t.Fatalf("got %s:%d after the rollback", s.Site.HostName, s.Site.PortNo)
+	}
+	list, _ = c.Versions()
+	if v := list[len(list)-1]; v.Version != 4 || v.Message != "rollback to version 1" {
+		t.Fatalf("got %+v", v)
+	}
+
+	if err := c.Rollback(42); err == nil {
+		t.Fatal("rollback to a version that is not in the history")
+	}
+}
+
+func TestRollbackWithErrors(t *testing.T) {
+	c := newTestConfig(t)
+
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(c.ConfigFilePath)
+	bad := strings.Replace(string(b), "portno           9000", "portno 0", 1)
+	if err := c.writeVersion(Version{Version: 3}, []byte(bad)); err != nil {
+		t.Fatal(err)
+	}
+
+	var verr *ValidationError
+	if err := c.Rollback(3); !errors.As(err, &verr) || errors.Is(err, ErrNotApplied) {
+		t.Fatalf("got %v; want a *ValidationError", err)
+	}
+	after, _ := os.ReadFile(c.ConfigFilePath)
+	if string(after) != string(b) {
+		t.Fatal("the config file was written")
+	}
+	if c.Snapshot().Site.PortNo != 9000 {
+		t.Fatal("the config in effect was changed")
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, 0},
+		{2, 2},
+		{-1, 5},
+	}
+	for _, tt := range tests {
+		c := newTestConfig(t, WithHistoryLimit(tt.limit))
+		for i := 0; i < 4; i++ {
+			if err := c.Set("Data", "n", string(rune('a'+i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		list, err := c.Versions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != tt.want {
+			t.Errorf("WithHistoryLimit(%d): got %d versions; want %d", tt.limit, len(list), tt.want)
+		}
+		if tt.limit > 0 && len(list) > 0 && list[len(list)-1].Version != 5 {
+			t.Errorf("WithHistoryLimit(%d): the last version is %d; want 5", tt.limit, list[len(list)-1].Version)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package webconfig
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// includeDirective includes other config files; i.e.
+	//
+	//	include  sites/*.cfg
+	includeDirective = "include"
+
+	// confDirName is the drop-in directory in /appdata/.cfg; its
+	// *.cfg files are read after the config file.
+	confDirName = "conf.d"
+	confFileExt = ".cfg"
+
+	// maxIncludeDepth limits the nesting of included files.
+	maxIncludeDepth = 10
+)
+
+// confDirPath returns the path of the drop-in directory.
+func (c *Config) confDirPath() string {
+	return fmt.Sprintf("%s/.cfg/%s", c.AppDataPath, confDirName)
+}
+
+// includesExist tells if the config of the snapshot c was read from
+// included files, or if there are files now that its include
+// directives (and the drop-in directory) match.
+func (c *Config) includesExist() bool {
+	if len(c.includes) > 0 {
+		return true
+	}
+	for i := 0; i < len(c.includePatterns); i++ {
+		if names, _ := filepath.Glob(c.includePatterns[i]); len(names) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// includeReader reads the included files; see readEntries.
+type includeReader struct {
+	c *Config
+
+	// files are the paths of the files that were read, patterns
+	// the paths and globs of the include directives and content
+	// the paths and contents of the files.
+	files    []string
+	patterns []string
+	content  bytes.Buffer
+}
+
+// readEntries returns the entries of the config file f, with the
+// entries of the included files in place of the include directives,
+// followed by those of the drop-in files (/appdata/.cfg/conf.d/*.cfg)
+// in lexical order. The entries are applied in this order, so a
+// value replaces the one before it (lists are not merged). Each file
+// starts outside of a section.
+func (c *Config) readEntries(f []byte) []entry {
+	r := &includeReader{c: c}
+
+	entries := r.read(c.ConfigFilePath, f, nil)
+
+	pattern := filepath.Join(c.confDirPath(), "*"+confFileExt)
+	r.patterns = append(r.patterns, pattern)
+	names, _ := filepath.Glob(pattern)
+	for i := 0; i < len(names); i++ {
+		entries = append(entries, r.readFile(names[i], nil, nil)...)
+	}
+
+	c.includes = r.files
+	c.includePatterns = r.patterns
+	c.includeHash = fileHash(r.content.Bytes())
+
+	return entries
+}
+
+// read returns the entries of the file path (with content data);
+// stack holds the files that include it.
+func (r *includeReader) read(path string, data []byte, stack []string) []entry {
+	entries, diags := r.c.parseEntries(path, data)
+	r.c.diagnostics = append(r.c.diagnostics, diags...)
+	stack = append(stack, filepath.Clean(path))
+
+	var list []entry
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		if e.Section != "" || e.Key != includeDirective {
+			list = append(list, *e)
+			continue
+		}
+
+		pattern, _, err := expandValue(e.Value)
+		if err != nil {
+			r.c.diagnostics.addf(e, SeverityError, true, "%v", err)
+			continue
+		}
+		if pattern == "" {
+			r.c.diagnostics.addf(e, SeverityError, false, "include needs a path or a glob pattern")
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		r.patterns = append(r.patterns, pattern)
+
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			r.c.diagnostics.addf(e, SeverityError, true, "invalid pattern %q: %v", e.Value, err)
+			continue
+		}
+		if len(names) == 0 && !hasGlobMeta(pattern) {
+			r.c.diagnostics.addf(e, SeverityError, true, "%s does not exist", pattern)
+			continue
+		}
+		for j := 0; j < len(names); j++ {
+			list = append(list, r.readFile(names[j], e, stack)...)
+		}
+	}
+
+	return list
+}
+
+// readFile reads an included file; e is the include directive (nil
+// for the drop-in files).
+func (r *includeReader) readFile(name string, e *entry, stack []string) []entry {
+	errorf := func(format string, a ...interface{}) []entry {
+		if e == nil {
+			e = &entry{File: name}
+		}
+		r.c.diagnostics.addf(e, SeverityError, true, format, a...)
+		return nil
+	}
+
+	if len(stack) >= maxIncludeDepth {
+		return errorf("%s: too many nested includes (more than %d)", name, maxIncludeDepth)
+	}
+	for i := 0; i < len(stack); i++ {
+		if stack[i] == filepath.Clean(name) {
+			return errorf("%s includes itself", name)
+		}
+	}
+
+	b, err := ReadFile(name)
+	if err != nil {
+		return errorf("%v", err)
+	}
+	r.files = append(r.files, name)
+	r.content.WriteString(name)
+	r.content.WriteByte(0)
+	r.content.Write(b)
+
+	return r.read(name, b, stack)
+}
+
+// isIncluded tells if a change to the file path should reload the
+// config, as it's (or may become) included.
+func (c *Config) isIncluded(path string) bool {
+	s := c.snapshot()
+	for i := 0; i < len(s.includePatterns); i++ {
+		if ok, _ := filepath.Match(s.includePatterns[i], path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// includeDirs returns the directories of the included files and
+// the drop-in directory; these are watched for changes.
+func (c *Config) includeDirs() []string {
+	s := c.snapshot()
+
+	var dirs []string
+	seen := make(map[string]bool)
+	add := func(dir string) {
+		if !seen[dir] && !hasGlobMeta(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for i := 0; i < len(s.includePatterns); i++ {
+		add(filepath.Dir(s.includePatterns[i]))
+	}
+	for i := 0; i < len(s.includes); i++ {
+		add(filepath.Dir(s.includes[i]))
+	}
+	return dirs
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
@@ -1,52 +1,182 @@
 package webconfig
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"os"
 )
 
 // NewPage initalizes the NewWebConfig. It creates the
 // default directories and starts the internal daemon.
+// The process exits if the config cannot be created or read;
+// see NewWebConfigE.
 func NewWebConfig(webRootPath string) *Config {
+	return NewWebConfigContext(context.Background(), webRootPath)
+}
+
+// NewWebConfigE is the same as NewWebConfig; it returns the
+// error instead of exiting.
+func NewWebConfigE(webRootPath string, opts ...Option) (*Config, error) {
+	return NewWebConfigContextE(context.Background(), webRootPath, opts...)
+}
+
+// NewWebConfigContext is the same as NewWebConfig; the internal
+// daemon (file watcher and banner timeout) stops when ctx is done
+// or Close is called.
+func NewWebConfigContext(ctx context.Context, webRootPath string, opts ...Option) *Config {
+	c, err := NewWebConfigContextE(ctx, webRootPath, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return c
+}
+
+// NewWebConfigContextE is the same as NewWebConfigContext; it
+// returns the error instead of exiting.
+func NewWebConfigContextE(ctx context.Context, webRootPath string, opts ...Option) (*Config, error) {
+	o := options{historyLimit: defaultHistoryLimit}
+	for i := 0; i < len(opts); i++ {
+		opts[i](&o)
+	}
+
 	var c Config
 	c.WebRootPath = webRootPath
-
-	c.refreshRate = 15
+	c.rt = &runtimeState{stop: make(chan struct{}), onError: o.onError, policy: o.policy}
+	c.rt.historyLimit = o.historyLimit
+	if o.pollInterval > 0 {
+		c.rt.pollInterval.Store(int64(o.pollInterval))
+	}
 
 	// Create the appdata if it does not exist
 	c.AppDataPath = fmt.Sprintf("%s/appdata", c.WebRootPath)
-	if !fileOrDirExists(c.AppDataPath) {
-		os.Mkdir(c.AppDataPath, os.ModePerm)
-	}
 	c.ConfigFilePath = fmt.Sprintf("%s/.cfg/.all", c.AppDataPath)
-
-	cfgDir := fmt.Sprintf("%s/.cfg", c.AppDataPath)
-	if !fileOrDirExists(cfgDir) {
-		os.Mkdir(cfgDir, os.ModePerm)
+	if o.format != "" {
+		f, err := lookupFormat(o.format)
+		if err != nil {
+			return nil, err
+		}
+		c.rt.format = f
+		if o.configFile == "" && !isAllFormat(f) {
+			if ext := f.Extensions(); len(ext) > 0 {
+				c.ConfigFilePath = fmt.Sprintf("%s/.cfg/config%s", c.AppDataPath, ext[0])
+			}
+		}
+	}
+	if o.configFile != "" {
+		c.ConfigFilePath = fmt.Sprintf("%s/.cfg/%s", c.AppDataPath, o.configFile)
 	}
 
-	certDir := fmt.Sprintf("%s/appdata/certs", c.WebRootPath)
-	if !fileOrDirExists(certDir) {
-		os.Mkdir(certDir, os.ModePerm)
+	dirs := []string{
+		c.AppDataPath,
+		fmt.Sprintf("%s/.cfg", c.AppDataPath),
+		c.confDirPath(),
+		fmt.Sprintf("%s/appdata/certs", c.WebRootPath),
+		fmt.Sprintf("%s/appdata/certs/self", c.WebRootPath),
 	}
-	selfcertDir := fmt.Sprintf("%s/appdata/certs/self", c.WebRootPath)
-	if !fileOrDirExists(selfcertDir) {
-		os.Mkdir(selfcertDir, os.ModePerm)
+	for i := 0; i < len(dirs); i++ {
+		if fileOrDirExists(dirs[i]) {
+			continue
+		}
+		if err := os.Mkdir(dirs[i], os.ModePerm); err != nil && !os.IsExist(err) {
+			return nil, err
+		}
 	}
 
 	if !fileOrDirExists(c.ConfigFilePath) {
-		c.writeDefaultConfig()
+		if err := c.writeDefaultConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	maintPagePath := c.maintPagePath()
+	if !fileOrDirExists(maintPagePath) {
+		if err := os.WriteFile(maintPagePath, []byte(cfgTemplateMaintPage), 0644); err != nil {
+			return nil, err
+		}
 	}
 
-	c.GetConfig()
+	if err := c.GetConfigE(); err != nil {
+		return nil, err
+	}
 
-	go c.refreshConfig()
+	c.rt.wg.Add(1)
+	go func() {
+		defer c.rt.wg.Done()
+		if o.polling {
+			c.pollConfig(c.rt.stop)
+			return
+		}
+		c.refreshConfig(c.rt.stop)
+	}()
 
-	// Need to do this on start.
-	if c.MessageBanner.On && c.MessageBanner.SecondsToDisplay > 0 {
-		c.MessageBanner.TickCount = c.MessageBanner.SecondsToDisplay
-		go c.setTimeoutResetMsgBanner()
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.Close()
+			case <-c.rt.stop:
+			}
+		}()
 	}
 
-	return &c
+	return &c, nil
+}
+
+// Close stops the internal daemon (file watcher and banner timeout)
+// and waits for it to exit. The last config values remain available;
+// GetConfig and UpdateConfigValue can still be called.
+func (c *Config) Close() error {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	if rt.closed {
+		rt.mu.Unlock()
+		return nil
+	}
+	rt.closed = true
+	if rt.stop != nil {
+		close(rt.stop)
+	}
+	rt.mu.Unlock()
+
+	rt.subs.mu.Lock()
+	rt.subs.closed = true
+	rt.subs.mu.Unlock()
+
+	rt.wg.Wait()
+
+	return nil
+}
+
+// reportError passes an error of the internal daemon to the error
+// handler (see WithErrorHandler); or logs it. The daemon keeps
+// running with the last good config.
+func (c *Config) reportError(err error) {
+	c = c.root()
+	if c.rt != nil && c.rt.onError != nil {
+		c.rt.onError(err)
+		return
+	}
+	log.Printf("webconfig: %v", err)
+}
+
+// reload is GetConfigE for the internal daemon; errors are reported
+// instead of returned. A config that was rejected is reported once,
+// not on every poll.
+func (c *Config) reload() {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	err := c.load()
+	repeated := err != nil && err == rt.reportedErr
+	rt.reportedErr = err
+	rt.mu.Unlock()
+
+	if err != nil && !repeated {
+		c.reportError(err)
+	}
 }
@@ -0,0 +1,271 @@
+package webconfig
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// IPMatcher holds a set of ip addresses, CIDR blocks and ranges;
+// all are kept as prefixes in a binary trie (one for IPv4 and one
+// for IPv6), so a lookup costs at most 32 (or 128) steps regardless
+// of the number of entries. The following formats are accepted:
+//
+//	10.12.3.4                  single address
+//	10.0.0.0/8, 2001:db8::/32  CIDR blocks
+//	10.0.0.1-10.0.0.50         ranges (inclusive)
+//	10.0.*.*, 10.0.*           IPv4 wildcards (trailing octets only)
+//	*                          everything
+//
+// An IPMatcher must not be modified once it is in use by a Config.
+type IPMatcher struct {
+	v4      *ipNode
+	v6      *ipNode
+	entries []string
+}
+
+type ipNode struct {
+	child [2]*ipNode
+	term  bool
+}
+
+// NewIPMatcher creates an IPMatcher from entries. Entries that cannot
+// be parsed are skipped; their errors are returned.
+func NewIPMatcher(entries []string) (*IPMatcher, []error) {
+	m := &IPMatcher{v4: &ipNode{}, v6: &ipNode{}}
+	var errs []error
+
+	for i := 0; i < len(entries); i++ {
+		if err := m.Add(entries[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return m, errs
+}
+
+// Add parses s and adds it to the matcher.
+func (m *IPMatcher) Add(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if m.v4 == nil {
+		m.v4 = &ipNode{}
+	}
+	if m.v6 == nil {
+		m.v6 = &ipNode{}
+	}
+
+	switch {
+	case s == "*":
+		m.v4.term = true
+		m.v6.term = true
+
+	case strings.Contains(s, "/"):
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		m.insert(p.Masked())
+
+	case strings.Contains(s, "*"):
+		p, err := parseIPWildcard(s)
+		if err != nil {
+			return err
+		}
+		m.insert(p)
+
+	case strings.Contains(s, "-"):
+		v := strings.SplitN(s, "-", 2)
+		lo, err := parseAddr(v[0])
+		if err != nil {
+			return fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		hi, err := parseAddr(v[1])
+		if err != nil {
+			return fmt.Errorf("invalid range %q: %w", s, err)
+		}
+		if lo.Is4() != hi.Is4() || hi.Less(lo) {
+			return fmt.Errorf("invalid range %q", s)
+		}
+		for lo.IsValid() && !hi.Less(lo) {
+			p := largestPrefixAt(lo, hi)
+			m.insert(p)
+			lo = lastAddr(p).Next()
+		}
+
+	default:
+		a, err := parseAddr(s)
+		if err != nil {
+			return err
+		}
+		m.insert(netip.PrefixFrom(a, a.BitLen()))
+	}
+
+	m.entries = append(m.entries, s)
+
+	return nil
+}
+
+// Len returns the number of entries that were added.
+func (m *IPMatcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.entries)
+}
+
+// Entries returns the entries as they were added.
+func (m *IPMatcher) Entries() []string {
+	if m == nil {
+		return nil
+	}
+	return append([]string(nil), m.entries...)
+}
+
+// Contains tells if ip is covered by any of the entries. ip can
+// be in the host:port form (as in http.Request.RemoteAddr).
+func (m *IPMatcher) Contains(ip string) bool {
+	if m == nil || ip == "" {
+		return false
+	}
+	a, err := parseAddr(ip)
+	if err != nil {
+		return false
+	}
+	return m.ContainsAddr(a)
+}
+
+// ContainsAddr is the same as Contains for a parsed address.
+func (m *IPMatcher) ContainsAddr(a netip.Addr) bool {
+	if m == nil || !a.IsValid() {
+		return false
+	}
+	a = a.Unmap()
+
+	n := m.v6
+	if a.Is4() {
+		n = m.v4
+	}
+	b := a.AsSlice()
+
+	for i := 0; n != nil; i++ {
+		if n.term {
+			return true
+		}
+		if i >= len(b)*8 {
+			break
+		}
+		n = n.child[bitAt(b, i)]
+	}
+
+	return false
+}
+
+// insert adds a prefix to the trie.
+func (m *IPMatcher) insert(p netip.Prefix) {
+	n := m.v6
+	if p.Addr().Is4() {
+		n = m.v4
+	}
+	b := p.Addr().AsSlice()
+
+	for i := 0; i < p.Bits(); i++ {
+		if n.term {
+			// a wider prefix already covers this one.
+			return
+		}
+		x := bitAt(b, i)
+		if n.child[x] == nil {
+			n.child[x] = &ipNode{}
+		}
+		n = n.child[x]
+	}
+	n.term = true
+
+	// anything under this node is now redundant.
+	n.child[0] = nil
+	n.child[1] = nil
+}
+
+// parseAddr parses an ip address; with or without the port, the
+// brackets of IPv6 and the zone. IPv4-mapped IPv6 addresses are
+// returned as IPv4.
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimPrefix(strings.TrimSuffix(s, "]"), "[")
+	if i := strings.Index(s, "%"); i > -1 {
+		s = s[:i]
+	}
+
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid ip address %q", s)
+	}
+
+	return a.Unmap(), nil
+}
+
+// parseIPWildcard converts an IPv4 wildcard (i.e. 10.0.*.* or 10.0.*)
+// to a prefix. Only the trailing octets can be wildcards.
+func parseIPWildcard(s string) (netip.Prefix, error) {
+	v := strings.Split(s, ".")
+	if len(v) > 4 {
+		return netip.Prefix{}, fmt.Errorf("invalid wildcard %q", s)
+	}
+
+	var b [4]byte
+	fixed := 0
+	for i := 0; i < len(v); i++ {
+		if v[i] == "*" {
+			continue
+		}
+		if fixed != i {
+			return netip.Prefix{}, fmt.Errorf("invalid wildcard %q: only trailing octets can be *", s)
+		}
+		a, err := netip.ParseAddr(fmt.Sprintf("%s.0.0.0", v[i]))
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid wildcard %q", s)
+		}
+		b[i] = a.As4()[0]
+		fixed++
+	}
+
+	return netip.PrefixFrom(netip.AddrFrom4(b), fixed*8), nil
+}
+
+// largestPrefixAt returns the widest prefix that begins with lo and
+// ends on or before hi.
+func largestPrefixAt(lo netip.Addr, hi netip.Addr) netip.Prefix {
+	for bits := 0; bits < lo.BitLen(); bits++ {
+		p := netip.PrefixFrom(lo, bits).Masked()
+		if p.Addr() != lo {
+			continue
+		}
+		if !hi.Less(lastAddr(p)) {
+			return p
+		}
+	}
+
+	return netip.PrefixFrom(lo, lo.BitLen())
+}
+
+// lastAddr returns the last address of a prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+
+	return a
+}
+
+func bitAt(b []byte, i int) int {
+	return int(b[i/8]>>(7-i%8)) & 1
+}
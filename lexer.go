@@ -0,0 +1,271 @@
+package webconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokBlank tokenKind = iota
+	tokComment
+	// tokKey is a key with or without a value; a key without a
+	// value can be a section header.
+	tokKey
+)
+
+// token is a line of the config file; a line that ends with a
+// backslash and the lines that continue it are one token.
+type token struct {
+	kind tokenKind
+
+	// raw is the source text, including the line ending(s); the
+	// tokens put together give back the file as it was.
+	raw string
+
+	// line is the (first) line number; the columns are 1-based.
+	line     int
+	col      int
+	valueCol int
+
+	// indent is the white space before the key, sep the white
+	// space between the key and the value on the first line, and
+	// eol the line ending of the last line ("\r\n", "\n" or "").
+	indent string
+	sep    string
+	eol    string
+
+	// key is as written; value has the continued lines put
+	// together, or is the text of a heredoc or a quoted string.
+	// heredoc is set for the latter; its text is kept verbatim.
+	key     string
+	value   string
+	heredoc bool
+
+	// err is the problem with the value; i.e. a heredoc that is
+	// not closed. warn is one that the value is read regardless of.
+	err  string
+	warn string
+}
+
+// lex splits the content of a config file into tokens.
+//
+// A value can span lines as a heredoc; the lines up to the one with
+// the tag alone are the value, as they are (without the last line
+// break). With <<- the indentation that the lines have in common is
+// removed; i.e.
+//
+//	cert <<EOT
+//	-----BEGIN CERTIFICATE-----
+//	...
+//	-----END CERTIFICATE-----
+//	EOT
+//
+// A value in double quotes is a quoted string with the escapes of Go
+// (\n, \t, \", \u00e9, ...); i.e. "  leading spaces\n". A value that
+// is not one Go string literal (i.e. "a" or "b") is taken as written.
+// ${VAR} is expanded in quoted values as in the others, but not in a
+// heredoc.
+func lex(data []byte) []token {
+	var toks []token
+
+	src := string(data)
+	lineNo := 1
+
+	next := func() string {
+		n := strings.IndexByte(src, '\n') + 1
+		if n == 0 {
+			n = len(src)
+		}
+		s := src[:n]
+		src = src[n:]
+		lineNo++
+		return s
+	}
+
+	for len(src) > 0 {
+		tok := token{line: lineNo}
+		tok.raw = next()
+
+		text := strings.TrimRight(tok.raw, " \t\r\n")
+		t := strings.TrimLeft(text, " \t")
+		tok.indent = text[:len(text)-len(t)]
+		tok.col = len(tok.indent) + 1
+
+		switch {
+		case t == "":
+			tok.kind = tokBlank
+
+		case strings.HasPrefix(t, "#"):
+			// comments do not continue on the next line.
+			tok.kind = tokComment
+
+		default:
+			tok.kind = tokKey
+
+			// Put the continuation of lines together.
+			for strings.HasSuffix(t, "\\") && len(src) > 0 {
+				s := next()
+				tok.raw += s
+				t = t[:len(t)-1] + strings.Trim(s, " \t\r\n")
+			}
+
+			tok.key = t
+			tok.valueCol = len(tok.indent) + len(t) + 1
+			if j := strings.IndexAny(t, " \t"); j > -1 {
+				tok.key = t[:j]
+				tok.value = strings.TrimLeft(t[j:], " \t")
+				tok.sep = t[j : len(t)-len(tok.value)]
+				tok.valueCol = len(tok.indent) + len(t) - len(tok.value) + 1
+			}
+
+			if tag, dedent, ok := heredocTag(tok.value); ok {
+				var lines []string
+				closed := false
+				for len(src) > 0 {
+					s := next()
+					tok.raw += s
+					l := strings.TrimRight(s, "\r\n")
+					if strings.TrimSpace(l) == tag {
+						closed = true
+						break
+					}
+					lines = append(lines, l)
+				}
+				if !closed {
+					tok.err = fmt.Sprintf("the heredoc is not closed; %s is missing", tag)
+				}
+				if dedent {
+					lines = dedentLines(lines)
+				}
+				tok.value = strings.Join(lines, "\n")
+				tok.heredoc = true
+			} else if len(tok.value) > 1 && strings.HasPrefix(tok.value, `"`) && strings.HasSuffix(tok.value, `"`) {
+				// Only a single Go string literal is a quoted value;
+				// others (i.e. "a" or "b") are taken as written.
+				if v, err := strconv.Unquote(tok.value); err == nil {
+					tok.value = v
+				} else if inner := tok.value[1 : len(tok.value)-1]; strings.Count(inner, `"`) == strings.Count(inner, `\"`) {
+					tok.warn = "not a valid quoted string (see the escapes of Go strings); the value is taken as written"
+				}
+			}
+		}
+
+		tok.eol = lineEnding(tok.raw)
+		toks = append(toks, tok)
+	}
+
+	return toks
+}
+
+// heredocTag returns the tag of a value that starts a heredoc
+// (<<EOT or <<-EOT); dedent is set for the latter.
+func heredocTag(v string) (tag string, dedent bool, ok bool) {
+	if !strings.HasPrefix(v, "<<") {
+		return "", false, false
+	}
+	tag = v[2:]
+	if strings.HasPrefix(tag, "-") {
+		tag = tag[1:]
+		dedent = true
+	}
+	if tag == "" {
+		return "", false, false
+	}
+	for i := 0; i < len(tag); i++ {
+		ch := tag[i]
+		if !(ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return "", false, false
+		}
+	}
+	return tag, dedent, true
+}
+
+// dedentLines removes the leading white space that the (non-blank)
+// lines have in common.
+func dedentLines(lines []string) []string {
+	prefix := ""
+	first := true
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		ws := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+		if first {
+			prefix = ws
+			first = false
+			continue
+		}
+		for !strings.HasPrefix(ws, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	list := make([]string, len(lines))
+	for i := 0; i < len(lines); i++ {
+		list[i] = strings.TrimPrefix(lines[i], prefix)
+	}
+	return list
+}
+
+// formatValue returns the text of the value v in the config file;
+// a value with line breaks is a heredoc (closed at indent), and one
+// that would not be read back as it is is quoted.
+func formatValue(v string, indent string, eol string) string {
+	_, _, heredoc := heredocTag(v)
+
+	switch {
+	case v == "":
+		return ""
+
+	case strings.Contains(v, "\n") && !hasControl(strings.ReplaceAll(v, "\n", "")):
+		tag := "EOT"
+		for n := 1; hasLine(v, tag); n++ {
+			tag = fmt.Sprintf("EOT%d", n)
+		}
+		if eol == "" {
+			eol = "\n"
+		}
+		return "<<" + tag + eol + strings.ReplaceAll(v, "\n", eol) + eol + indent + tag
+
+	case heredoc, hasControl(v), v != strings.Trim(v, " \t"),
+		strings.HasPrefix(v, `"`), strings.HasSuffix(v, "\\"):
+		return strconv.Quote(v)
+	}
+
+	return v
+}
+
+// hasControl tells if s has control characters other than tabs.
+func hasControl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' && s[i] != '\t' || s[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLine tells if a line of v is tag (i.e. would close a heredoc).
+func hasLine(v string, tag string) bool {
+	lines := strings.Split(v, "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// lineEnding returns the line ending of the last line of s.
+func lineEnding(s string) string {
+	switch {
+	case strings.HasSuffix(s, "\r\n"):
+		return "\r\n"
+	case strings.HasSuffix(s, "\n"):
+		return "\n"
+	}
+	return ""
+}
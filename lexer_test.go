@@ -0,0 +1,166 @@
+package webconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		value   string
+		heredoc bool
+		err     string
+		warn    bool
+	}{
+		{"plain", "k  a b \n", "a b", false, "", false},
+		{"continued", "k a \\\n   b\n", "a b", false, "", false},
+		{"heredoc", "k <<EOT\n  line 1\nline ${2}\nEOT\n", "  line 1\nline ${2}", true, "", false},
+		{"heredoc crlf", "k <<EOT\r\na\r\nb\r\nEOT\r\n", "a\nb", true, "", false},
+		{"indented tag", "   k <<EOT\n   a\n   EOT\n", "   a", true, "", false},
+		{"dedent", "   k <<-EOT\n      a\n        b\n   EOT\n", "a\n  b", true, "", false},
+		{"empty heredoc", "k <<EOT\nEOT\n", "", true, "", false},
+		{"not closed", "k <<EOT\na\n", "a", true, "not closed; EOT is missing", false},
+		{"not a tag", "k <<a b\n", "<<a b", false, "", false},
+		{"quoted", "k \"  a\\tb\\n\\u00e9\"\n", "  a\tb\n\u00e9", false, "", false},
+		{"quoted empty", "k \"\"\n", "", false, "", false},
+		{"one quote", "k \"\n", "\"", false, "", false},
+		{"invalid escape", "k \"\\q\"\n", "\"\\q\"", false, "", true},
+		{"windows path", "k \"C:\\Users\\me\"\n", "\"C:\\Users\\me\"", false, "", true},
+		{"windows path escape", "k \"C:\\temp\"\n", "C:\temp", false, "", false},
+		{"two strings", "k \"a\" or \"b\"\n", "\"a\" or \"b\"", false, "", false},
+		{"escaped quote", "k \"say \\\"hi\\\"\"\n", "say \"hi\"", false, "", false},
+		{"inner quote", "k \"a\"b\"\n", "\"a\"b\"", false, "", false},
+	}
+	for _, tt := range tests {
+		toks := lex([]byte(tt.in))
+		if len(toks) != 1 || toks[0].kind != tokKey {
+			t.Errorf("%s: got %d tokens; want a key", tt.name, len(toks))
+			continue
+		}
+		tok := toks[0]
+		if tok.value != tt.value || tok.heredoc != tt.heredoc {
+			t.Errorf("%s: got %q (heredoc %v); want %q (heredoc %v)", tt.name, tok.value, tok.heredoc, tt.value, tt.heredoc)
+		}
+		if tt.err == "" && tok.err != "" || !strings.Contains(tok.err, tt.err) {
+			t.Errorf("%s: got error %q; want %q", tt.name, tok.err, tt.err)
+		}
+		if (tok.warn != "") != tt.warn {
+			t.Errorf("%s: got warning %q; want %v", tt.name, tok.warn, tt.warn)
+		}
+		if tok.raw != tt.in {
+			t.Errorf("%s: raw is %q", tt.name, tok.raw)
+		}
+	}
+}
+
+var formatValueTests = []string{
+	"",
+	"plain",
+	"a  b",
+	" leading",
+	"trailing\t",
+	"\"quoted\"",
+	"<<EOT",
+	"ends with \\",
+	"tab\tinside",
+	"bell\a",
+	"line 1\nline 2",
+	"line 1\nEOT\nline 3",
+	"\n",
+	"a\n",
+	"crlf\r\nline",
+	"${VAR}",
+	"caf\u00e9",
+	"\xff\xfe",
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, v := range formatValueTests {
+		testFormatValue(t, v)
+	}
+}
+
+func testFormatValue(t *testing.T, v string) {
+	t.Helper()
+	in := "Data\n   k " + formatValue(v, "   ", "\n") + "\n   next x\n"
+	toks := lex([]byte(in))
+	if len(toks) != 3 || toks[1].value != v || toks[1].err != "" || toks[2].key != "next" {
+		t.Fatalf("formatValue(%q) is not read back:\n%s", v, in)
+	}
+	heredoc := strings.Contains(v, "\n") && !hasControl(strings.ReplaceAll(v, "\n", ""))
+	if toks[1].heredoc != heredoc {
+		t.Errorf("formatValue(%q): heredoc is %v", v, toks[1].heredoc)
+	}
+}
+
+func FuzzFormatValue(f *testing.F) {
+	for _, v := range formatValueTests {
+		f.Add(v)
+	}
+	f.Fuzz(func(t *testing.T, v string) {
+		testFormatValue(t, v)
+	})
+}
+
+func TestHeredocEnv(t *testing.T) {
+	t.Setenv("WC_NAME", "world")
+
+	c := newTestConfig(t)
+	s := readTestConfig(t, c, "Site\n   portno 80\n   proto http\nHTTP\n   allowed-methods GET\n"+
+		"Data\n"+
+		"   script <<EOT\necho ${WC_NAME} ${HOME\nEOT\n"+
+		"   dedented <<-EOT\n      ${WC_NAME}\n   EOT\n"+
+		"   quoted \"hello,\\n${WC_NAME}\"\n"+
+		"   plain hello ${WC_NAME}\n")
+
+	if d := s.Diagnostics(); len(d) > 0 {
+		t.Fatalf("diagnostics: %v", d)
+	}
+	data := map[string]string{
+		"script":   "echo ${WC_NAME} ${HOME",
+		"dedented": "${WC_NAME}",
+		"quoted":   "hello,\nworld",
+		"plain":    "hello world",
+	}
+	for k, want := range data {
+		if v, _ := s.DataValue(k); v != want {
+			t.Errorf("Data %s: got %q; want %q", k, v, want)
+		}
+	}
+
+	// A value set with line breaks is written as a heredoc, so it's
+	// not expanded either.
+	if err := c.Set("Data", "pem", "-----BEGIN-----\n${WC_NAME}\n-----END-----"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Snapshot().DataValue("pem"); v != "-----BEGIN-----\n${WC_NAME}\n-----END-----" {
+		t.Errorf("Data pem: got %q", v)
+	}
+}
+
+// TestQuotedValues reads values that begin and end with a quote but
+// are not one Go string literal; they're taken as written.
+func TestQuotedValues(t *testing.T) {
+	c := newTestConfig(t)
+	s := readTestConfig(t, c, "Site\n   portno 80\n   proto http\nHTTP\n   allowed-methods GET\n"+
+		"Data\n"+
+		"   choice \"a\" or \"b\"\n"+
+		"   home   \"C:\\Users\\me\"\n"+
+		"   temp   \"C:\\\\temp\"\n")
+
+	if d := s.Diagnostics(); HasErrors(d) || len(d) != 1 || d[0].Key != "home" || d[0].Severity != SeverityWarning {
+		t.Errorf("got %v; want a warning for home", d)
+	}
+	data := map[string]string{
+		"choice": `"a" or "b"`,
+		"home":   `"C:\Users\me"`,
+		"temp":   `C:\temp`,
+	}
+	for k, want := range data {
+		if v, _ := s.DataValue(k); v != want {
+			t.Errorf("Data %s: got %q; want %q", k, v, want)
+		}
+	}
+}
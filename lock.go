@@ -0,0 +1,29 @@
+package webconfig
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockConfig takes the lock of the config file, which is shared by
+// all processes that use the same web root; the returned func
+// releases it. The lock is advisory and on a file of its own
+// (/appdata/.cfg/.all.lock), as the config file is replaced (not
+// rewritten) on each change. The caller must hold rt.mu.
+func (c *Config) lockConfig() (func(), error) {
+	path := fmt.Sprintf("%s/.cfg/.all.lock", c.AppDataPath)
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
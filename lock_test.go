@@ -0,0 +1,122 @@
+package webconfig
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateConflict(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+
+	// Another writer changes the file; the config has not been
+	// reloaded yet.
+	b, _ := os.ReadFile(c.ConfigFilePath)
+	if err := os.WriteFile(c.ConfigFilePath, append(b, "\nData\n   other writer\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Set("Site", "portno", "9000"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v; want ErrConflict", err)
+	}
+	if v, _ := c.Snapshot().DataValue("other"); v != "writer" {
+		t.Fatal("the config was not reloaded after the conflict")
+	}
+
+	// A retry works on the file that was reloaded.
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+	s := c.Snapshot()
+	if v, _ := s.DataValue("other"); s.Site.PortNo != 9000 || v != "writer" {
+		t.Fatal("the edit of the other writer was lost")
+	}
+}
+
+func TestCompareAndUpdate(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+
+	set := func(tx *Tx) error {
+		return tx.Set("Data", "k", "v")
+	}
+
+	old := c.Snapshot()
+	if err := c.Set("Site", "portno", "9000"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want error
+	}{
+		{"blank", "", ErrConflict},
+		{"stale snapshot", old.ConfigFileLastHash, ErrConflict},
+		{"current snapshot", c.Snapshot().ConfigFileLastHash, nil},
+	}
+	for _, tt := range tests {
+		if err := c.CompareAndUpdate(tt.hash, set); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v; want %v", tt.name, err, tt.want)
+		}
+	}
+	if v, _ := c.Snapshot().DataValue("k"); v != "v" {
+		t.Fatal("the edit was not applied")
+	}
+}
+
+// TestConcurrentUpdates runs read-modify-write cycles of two Configs
+// on the same web root, as two processes would; no increment may be
+// lost.
+func TestConcurrentUpdates(t *testing.T) {
+	root := t.TempDir()
+	var configs []*Config
+	for i := 0; i < 2; i++ {
+		c, err := NewWebConfigE(root, WithPolling(), WithPollInterval(time.Hour), WithHistoryLimit(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		configs = append(configs, c)
+	}
+
+	const n = 10
+	increment := func(tx *Tx) error {
+		v, _ := tx.Get("Data", "counter")
+		i, _ := strconv.Atoi(v)
+		return tx.Set("Data", "counter", strconv.Itoa(i+1))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < len(configs); i++ {
+		c := configs[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				err := c.Update(increment)
+				for errors.Is(err, ErrConflict) {
+					err = c.Update(increment)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := configs[0].GetConfigE(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := configs[0].Snapshot().DataValue("counter"); v != strconv.Itoa(2*n) {
+		t.Fatalf("got counter %s; want %d", v, 2*n)
+	}
+}
@@ -0,0 +1,178 @@
+package webconfig
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maintenance holds the settings of the Maintenance section; they're
+// used when the maintenance-window is on or scheduled.
+type maintenance struct {
+	// Start and End schedule the window; it opens on Start
+	// and closes on End. Either can be zero.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// RetryAfter is the value of the Retry-After header (in seconds),
+	// when End is not set.
+	RetryAfter int `json:"retry-after"`
+
+	// BypassIP and BypassPaths are served normally during the
+	// window; i.e. admin ip addresses and /healthz.
+	BypassIP    []string `json:"bypass-ip"`
+	BypassPaths []string `json:"bypass-paths"`
+
+	bypassIP *IPMatcher
+
+	// page is the template of the maintenance page; it's parsed when
+	// the config is read. See ServeMaintenancePage.
+	page *template.Template
+}
+
+// defaultRetryAfter is used when retry-after is not set.
+const defaultRetryAfter = 300
+
+// defaultMaintPage is the built-in maintenance page; it's used if
+// /appdata/maint-page.html does not exist or cannot be parsed.
+var defaultMaintPage = template.Must(template.New("maint-page").Parse(cfgTemplateMaintPage))
+
+// maintTimeLayouts are the accepted formats of start and end; the
+// ones without a zone are in local time.
+var maintTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// InMaintenance tells if the site is in the maintenance window now.
+// The window is open if maintenance-window is on or the start time
+// has passed; and closed once the end time has passed.
+func (c *Config) InMaintenance() bool {
+	return c.snapshot().inMaintenanceAt(time.Now())
+}
+
+func (c *Config) inMaintenanceAt(now time.Time) bool {
+	m := c.Maintenance
+
+	if !c.MaintenanceWindowOn && m.Start.IsZero() {
+		return false
+	}
+	if !m.Start.IsZero() && now.Before(m.Start) {
+		return false
+	}
+	if !m.End.IsZero() && !now.Before(m.End) {
+		return false
+	}
+
+	return true
+}
+
+// maintenanceBypass tells if the request can be served during the
+// maintenance window; by its ip addr or url path.
+func (c *Config) maintenanceBypass(ip string, rPath string) bool {
+	if c.Maintenance.bypassIP.Contains(ip) {
+		return true
+	}
+
+	for i := 0; i < len(c.Maintenance.BypassPaths); i++ {
+		p := strings.ToLower(c.Maintenance.BypassPaths[i])
+		if p == rPath {
+			return true
+		}
+		// a path ending with a slash covers everything under it.
+		if strings.HasSuffix(p, "/") && strings.HasPrefix(rPath, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryAfter returns the seconds that clients are asked to wait
+// before trying again.
+func (c *Config) retryAfter(now time.Time) int {
+	if !c.Maintenance.End.IsZero() {
+		sec := int(c.Maintenance.End.Sub(now).Seconds())
+		if sec < 1 {
+			sec = 1
+		}
+		return sec
+	}
+	if c.Maintenance.RetryAfter > 0 {
+		return c.Maintenance.RetryAfter
+	}
+
+	return defaultRetryAfter
+}
+
+// ServeMaintenancePage writes the maintenance page with the 503 status.
+// The html template is in /appdata/maint-page.html; it's executed with
+// the hostname, the end time of the window (if set) and the retry-after
+// seconds (.HostName, .End, .RetryAfter). The template is read with the
+// config (and again when it changes); an error in it is reported in the
+// Diagnostics and the built-in page is used.
+func (c *Config) ServeMaintenancePage(w http.ResponseWriter, r *http.Request) {
+	c = c.snapshot()
+	now := time.Now()
+	retry := c.retryAfter(now)
+
+	t := c.Maintenance.page
+	if t == nil {
+		t = defaultMaintPage
+	}
+
+	data := struct {
+		HostName   string
+		End        time.Time
+		RetryAfter int
+	}{c.Site.HostName, c.Maintenance.End, retry}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	t.Execute(w, data)
+}
+
+// parseMaintPage parses the template of the maintenance page from
+// the content of /appdata/maint-page.html; blank if it does not exist.
+func (c *Config) parseMaintPage(b []byte) {
+	c.Maintenance.page = defaultMaintPage
+	if b == nil {
+		return
+	}
+	t, err := template.New("maint-page").Parse(string(b))
+	if err != nil {
+		e := &entry{File: c.maintPagePath()}
+		c.diagnostics.addf(e, SeverityWarning, false, "%v; the built-in page is used", err)
+		return
+	}
+	c.Maintenance.page = t
+}
+
+// maintPagePath is the location of the maintenance html template.
+func (c *Config) maintPagePath() string {
+	return fmt.Sprintf("%s/%s", c.AppDataPath, maintPageFileName)
+}
+
+// parseMaintTime parses the start and end values; blank
+// means not set.
+func parseMaintTime(s string) (time.Time, error) {
+	s = strings.Trim(s, " ")
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for i := 0; i < len(maintTimeLayouts); i++ {
+		t, err := time.ParseInLocation(maintTimeLayouts[i], s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
@@ -0,0 +1,45 @@
+package webconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServeMaintenancePage(t *testing.T) {
+	c := newTestConfig(t)
+
+	tests := []struct {
+		page     string
+		body     string
+		warnings int
+	}{
+		{"<p>{{.HostName}} is down</p>", "<p>localhost is down</p>", 0},
+		{"<p>{{.HostName</p>", "Down for maintenance", 1},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(c.maintPagePath(), []byte(tt.page), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.GetConfigE(); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		c.ServeMaintenancePage(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("%q: got %d %q; want %q", tt.page, w.Code, w.Body.String(), tt.body)
+		}
+
+		warnings := 0
+		for _, d := range c.Diagnostics() {
+			if d.File == c.maintPagePath() {
+				warnings++
+			}
+		}
+		if warnings != tt.warnings {
+			t.Errorf("%q: got %d warnings; want %d", tt.page, warnings, tt.warnings)
+		}
+	}
+}
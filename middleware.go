@@ -0,0 +1,119 @@
+package webconfig
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ErrorPageFunc writes the response of a request that did not pass
+// ValidateHTTPRequest; statusCode is the code that was returned.
+type ErrorPageFunc func(w http.ResponseWriter, r *http.Request, statusCode int)
+
+// SetErrorPage sets the renderer for a status code returned by
+// ValidateHTTPRequest (i.e. 404, 405). A statusCode of 0 sets the
+// renderer for all codes that do not have their own. A nil fn
+// removes the renderer. The default writes the status text; and
+// the maintenance page for 503. Blocked ip addresses are answered
+// with 403; by the renderer of StatusBlockedIP, if it's set, or else
+// the one of 403.
+func (c *Config) SetErrorPage(statusCode int, fn ErrorPageFunc) {
+	c.errorPagesMu.Lock()
+	defer c.errorPagesMu.Unlock()
+
+	if c.errorPages == nil {
+		c.errorPages = make(map[int]ErrorPageFunc)
+	}
+	if fn == nil {
+		delete(c.errorPages, statusCode)
+		return
+	}
+	c.errorPages[statusCode] = fn
+}
+
+// Middleware returns a handler that validates every request with
+// ValidateHTTPRequest before passing it to next. Requests that fail
+// are answered with the error page of their status code (see
+// SetErrorPage); redirects (forward-paths) and dropped connections
+// (DropBlockedConnections) are left as they are. The signature
+// fits net/http, chi (r.Use) and gorilla/mux (r.Use).
+func (c *Config) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hw := &responseRecorder{ResponseWriter: w}
+
+		ok, code := c.ValidateHTTPRequest(hw, r)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if hw.hijacked || hw.written {
+			// the response is already taken care of.
+			return
+		}
+
+		c.writeErrorPage(w, r, code)
+	})
+}
+
+// writeErrorPage writes the response for statusCode with the
+// renderer that was set for it; or the default one.
+func (c *Config) writeErrorPage(w http.ResponseWriter, r *http.Request, statusCode int) {
+	c.errorPagesMu.RLock()
+	fn := c.errorPages[statusCode]
+	if statusCode == StatusBlockedIP {
+		if fn == nil {
+			fn = c.errorPages[http.StatusForbidden]
+		}
+		statusCode = http.StatusForbidden
+	}
+	fnAll := c.errorPages[0]
+	c.errorPagesMu.RUnlock()
+
+	if fn == nil && statusCode == http.StatusServiceUnavailable {
+		c.ServeMaintenancePage(w, r)
+		return
+	}
+	if fn == nil {
+		fn = fnAll
+	}
+	if fn == nil {
+		fn = defaultErrorPage
+	}
+	fn(w, r, statusCode)
+}
+
+func defaultErrorPage(w http.ResponseWriter, r *http.Request, statusCode int) {
+	http.Error(w, http.StatusText(statusCode), statusCode)
+}
+
+// responseRecorder records whether the response was written (i.e.
+// the redirect of forward-paths) or the connection was hijacked (see
+// DropBlockedConnections) during validation.
+type responseRecorder struct {
+	http.ResponseWriter
+	written  bool
+	hijacked bool
+}
+
+func (h *responseRecorder) WriteHeader(statusCode int) {
+	h.written = true
+	h.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (h *responseRecorder) Write(b []byte) (int, error) {
+	h.written = true
+	return h.ResponseWriter.Write(b)
+}
+
+func (h *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := h.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		h.hijacked = true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,49 @@
+package webconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	c := newTestConfig(t)
+	err := c.Update(func(tx *Tx) error {
+		if err := tx.Set("URLPaths", "forward-paths", "/old|/new"); err != nil {
+			return err
+		}
+		rule := `[{"rule-type":"ip-address","url-path":"/temp","serve-only-to-criteria":["10.0.0.1"],"http-status-code":307}]`
+		return tx.Set("URLPaths", "conditional-http-service", rule)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetErrorPage(http.StatusTemporaryRedirect, func(w http.ResponseWriter, r *http.Request, code int) {
+		http.Redirect(w, r, "/elsewhere", code)
+	})
+
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+		body     string
+	}{
+		{"/", http.StatusOK, "", "ok"},
+		{"/old", http.StatusTemporaryRedirect, "/new", ""},
+		{"/temp", http.StatusTemporaryRedirect, "/elsewhere", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s: got %d %q; want %d %q", tt.path, w.Code, w.Header().Get("Location"), tt.code, tt.location)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: got body %q; want %q", tt.path, w.Body.String(), tt.body)
+		}
+	}
+}
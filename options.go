@@ -0,0 +1,97 @@
+package webconfig
+
+import "time"
+
+// Option sets an option of NewWebConfigContext.
+type Option func(*options)
+
+type options struct {
+	pollInterval time.Duration
+	polling      bool
+	onError      func(error)
+	policy       InvalidConfigPolicy
+	historyLimit int
+	format       string
+	configFile   string
+}
+
+// InvalidConfigPolicy tells what to do when the config file has
+// errors; see Diagnostics.
+type InvalidConfigPolicy int
+
+const (
+	// KeepLastGoodConfig keeps the current config in effect and
+	// reports a *ValidationError if the file has errors that the
+	// config in effect does not have; this is the default. The
+	// config that is read at start-up is always applied, as there is
+	// no previous one.
+	KeepLastGoodConfig InvalidConfigPolicy = iota
+
+	// ApplyInvalidConfig applies the values that could be read;
+	// the errors are only logged.
+	ApplyInvalidConfig
+)
+
+// WithPollInterval sets how often the config files are checked
+// for changes when they are polled; see SetPollInterval.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = d
+	}
+}
+
+// WithPolling polls the config files instead of watching them for
+// file-system notifications; i.e. on network file systems, where
+// notifications are not reliable.
+func WithPolling() Option {
+	return func(o *options) {
+		o.polling = true
+	}
+}
+
+// WithErrorHandler sets the func that receives the errors of the
+// internal daemon; i.e. the config file could not be read during a
+// reload. The last good config is kept in effect. The default
+// handler logs the error.
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// WithInvalidConfigPolicy sets what to do when a reload finds
+// errors in the config file; the default is KeepLastGoodConfig.
+func WithInvalidConfigPolicy(p InvalidConfigPolicy) Option {
+	return func(o *options) {
+		o.policy = p
+	}
+}
+
+// WithHistoryLimit sets the number of versions of the config file
+// that are kept in the history; the oldest are removed. The default
+// is 100; 0 turns the history off and a negative n keeps all
+// versions.
+func WithHistoryLimit(n int) Option {
+	return func(o *options) {
+		o.historyLimit = n
+	}
+}
+
+// WithConfigFile sets the name of the config file in /appdata/.cfg
+// (.all by default); the format is chosen by the extension, i.e.
+// config.yaml is read as YAML. See Format.
+func WithConfigFile(name string) Option {
+	return func(o *options) {
+		o.configFile = name
+	}
+}
+
+// WithFormat sets the format of the config file (all, json, yaml,
+// toml or one added by RegisterFormat) regardless of its extension.
+// If the name of the file is not set by WithConfigFile, it's config
+// with the extension of the format; i.e. config.yaml.
+func WithFormat(name string) Option {
+	return func(o *options) {
+		o.format = name
+	}
+}
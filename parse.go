@@ -0,0 +1,116 @@
+package webconfig
+
+import (
+	"errors"
+	"sort"
+)
+
+// entry is a key/value of the config file; Section is blank for
+// the top-level keys (i.e. maintenance-window). EnvVar is set for
+// the values of environment variables and EnvVars are the variables
+// that were expanded in Value; see ValueSource.
+type entry struct {
+	Section  string
+	Key      string
+	Value    string
+	File     string
+	Line     int
+	Col      int
+	ValueCol int
+	EnvVar   string
+	EnvVars  []string
+
+	// Secret is set if the value was encrypted; see EncryptValue.
+	Secret bool
+
+	// Heredoc is set if the value is the text of a heredoc; ${VAR}
+	// is not expanded in it (see expandEnv).
+	Heredoc bool
+}
+
+// sectionDef describes a built-in section; Keys is nil for
+// sections that take any key (Data).
+type sectionDef struct {
+	Name string
+	Keys []string
+}
+
+// sectionDefs are the built-in sections; by lower-case name.
+var sectionDefs = map[string]sectionDef{
+	"site":          {"Site", []string{"hostname", "alternate-hostnames", "portno", "proto"}},
+	"tls":           {"TLS", []string{"cert", "key"}},
+	"maintenance":   {"Maintenance", []string{"start", "end", "retry-after", "bypass-ip", "bypass-paths"}},
+	"admin":         {"Admin", []string{"allowed-ip-addr", "run-on-startup", "portno"}},
+	"messagebanner": {"MessageBanner", []string{"display-mode", "seconds-to-display"}},
+	"urlpaths":      {"URLPaths", []string{"restrict-paths", "exclude-paths", "forward-paths", "conditional-http-service"}},
+	"http":          {"HTTP", []string{"allowed-methods", "trusted-proxies"}},
+	"data":          {"Data", nil},
+}
+
+// topLevelKeys are the keys that do not belong to a section.
+var topLevelKeys = []string{"maintenance-window", "redirect-http-to-https"}
+
+const dataSection = "Data"
+
+// isTopLevelKey tells if key does not belong to a section; the
+// include directive is one too.
+func isTopLevelKey(key string) bool {
+	if key == includeDirective {
+		return true
+	}
+	for i := 0; i < len(topLevelKeys); i++ {
+		if topLevelKeys[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sectionsOfKey returns the built-in sections that have key.
+func sectionsOfKey(key string) []string {
+	var list []string
+	for _, def := range sectionDefs {
+		for i := 0; i < len(def.Keys); i++ {
+			if def.Keys[i] == key {
+				list = append(list, def.Name)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// hasKey tells if the section has key; sections that take any
+// key and unknown sections have all keys.
+func (d sectionDef) hasKey(key string) bool {
+	if d.Keys == nil {
+		return true
+	}
+	for i := 0; i < len(d.Keys); i++ {
+		if d.Keys[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEntries reads the key/values of a config file in its format
+// (see Format and parseAST).
+func (c *Config) parseEntries(file string, f []byte) ([]entry, []Diagnostic) {
+	a, err := decodeAST(file, c.fileFormat(file), f)
+	if err != nil {
+		var diags diagList
+		e := &entry{File: file}
+		var ferr *FormatError
+		if errors.As(err, &ferr) && ferr.Line > 0 {
+			e.Line = ferr.Line
+			e.Col = 1
+			err = errors.New(ferr.Msg)
+		}
+		diags.addf(e, SeverityError, false, "%v", err)
+		return nil, diags
+	}
+	entries := a.entries()
+
+	return entries, a.diags
+}
@@ -0,0 +1,107 @@
+package webconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readTestConfig writes content as the config file of c and reads it;
+// the config is applied even if it has errors.
+func readTestConfig(t *testing.T, c *Config, content string) *Config {
+	t.Helper()
+	if err := os.WriteFile(c.ConfigFilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.GetConfigE()
+	return c.Snapshot()
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newTestConfig(t, WithInvalidConfigPolicy(ApplyInvalidConfig))
+
+	const base = "Site\n   portno 80\n   proto http\nHTTP\n   allowed-methods GET\n"
+	tests := []struct {
+		name    string
+		content string
+		line    int
+		sev     Severity
+		msg     string
+	}{
+		{"unknown section", base + "Sitex\n   a b\n", 6, SeverityWarning, "unknown section"},
+		{"unknown key", base + "Site\n   colour blue\n", 7, SeverityWarning, "unknown key"},
+		{"bad number", "Site\n   portno 80x\n   proto http\nHTTP\n   allowed-methods GET\n", 2, SeverityError, "invalid number"},
+		{"bad switch", base + "maintenance-window maybe\n", 6, SeverityError, "expected on/off"},
+		{"duplicate", base + "Site\n   portno 81\n", 7, SeverityWarning, "duplicate key"},
+		{"bad json", base + "URLPaths\n   conditional-http-service [{\n", 7, SeverityError, "invalid JSON"},
+		{"forward-path url-to", base + "URLPaths\n   forward-paths /a|http://x\n", 7, SeverityError, "invalid forward-path"},
+		{"forward-path url-from", base + "URLPaths\n   forward-paths a|/b\n", 7, SeverityWarning, "url-from must begin with /"},
+	}
+	for _, tt := range tests {
+		s := readTestConfig(t, c, tt.content)
+		found := false
+		for _, d := range s.Diagnostics() {
+			if d.Line == tt.line && d.Severity == tt.sev && strings.Contains(d.Message, tt.msg) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no %s %q on line %d in %v", tt.name, tt.sev, tt.msg, tt.line, s.Diagnostics())
+		}
+	}
+}
+
+func TestSwitchValues(t *testing.T) {
+	c := newTestConfig(t, WithInvalidConfigPolicy(ApplyInvalidConfig))
+
+	tests := []struct {
+		value string
+		on    bool
+	}{
+		{"on", true}, {"ON", true}, {"yes", true}, {"true", true}, {"1", true},
+		{"off", false}, {"no", false}, {"false", false}, {"0", false}, {"", false},
+	}
+	for _, tt := range tests {
+		s := readTestConfig(t, c, "maintenance-window "+tt.value+"\nMessageBanner\n   display-mode "+tt.value+"\n")
+		if s.MaintenanceWindowOn != tt.on || s.MessageBanner.On != tt.on {
+			t.Errorf("%q: got %v, %v; want %v", tt.value, s.MaintenanceWindowOn, s.MessageBanner.On, tt.on)
+		}
+	}
+}
+
+func TestReloadUnchanged(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+
+	s := c.Snapshot()
+	if err := c.GetConfigE(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Snapshot() != s {
+		t.Fatal("the config was read again; the files have not changed")
+	}
+
+	// A drop-in file is read, though the config file has not changed.
+	dir := c.confDirPath()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "10-local.cfg"), []byte("Site\n   portno 9000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetConfigE(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Snapshot().Site.PortNo != 9000 {
+		t.Fatal("the drop-in file was not read")
+	}
+
+	s = c.Snapshot()
+	if err := c.GetConfigE(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Snapshot() != s {
+		t.Fatal("the config was applied again; the files have not changed")
+	}
+}
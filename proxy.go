@@ -0,0 +1,102 @@
+package webconfig
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the ip addr of the client that made the request.
+// If the immediate peer (r.RemoteAddr) is one of the trusted-proxies,
+// the address is taken from the forwarding headers in this order:
+// Forwarded (RFC 7239), X-Forwarded-For and X-Real-IP. The hops are
+// walked from right to left; the first one that is not a trusted proxy
+// is the client. Headers sent by untrusted peers are ignored, as
+// they can be set to anything by the client.
+func (c *Config) ClientIP(r *http.Request) string {
+	c = c.snapshot()
+
+	peer, err := parseAddr(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	if !c.trustedProxies.ContainsAddr(peer) {
+		return peer.String()
+	}
+
+	hops := forwardedHops(r.Header)
+	if len(hops) == 0 {
+		hops = xForwardedForHops(r.Header)
+	}
+	if len(hops) == 0 {
+		if a, err := parseAddr(r.Header.Get("X-Real-IP")); err == nil {
+			return a.String()
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i > -1; i-- {
+		a, err := parseAddr(hops[i])
+		if err != nil {
+			// obfuscated (i.e. _hidden), unknown or garbage; the last
+			// valid hop is the best we know.
+			break
+		}
+		client = a
+		if !c.trustedProxies.ContainsAddr(a) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// IsTrustedProxy tells if ip is listed in trusted-proxies.
+func (c *Config) IsTrustedProxy(ip string) bool {
+	return c.snapshot().trustedProxies.Contains(ip)
+}
+
+// xForwardedForHops returns the addresses of all X-Forwarded-For
+// headers; left-most is the original client.
+func xForwardedForHops(h http.Header) []string {
+	var hops []string
+
+	v := h.Values("X-Forwarded-For")
+	for i := 0; i < len(v); i++ {
+		ips := strings.Split(v[i], ",")
+		for j := 0; j < len(ips); j++ {
+			s := strings.TrimSpace(ips[j])
+			if s != "" {
+				hops = append(hops, s)
+			}
+		}
+	}
+
+	return hops
+}
+
+// forwardedHops returns the for= addresses of all Forwarded headers;
+// e.g.
+//
+//	Forwarded: for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https
+func forwardedHops(h http.Header) []string {
+	var hops []string
+
+	v := h.Values("Forwarded")
+	for i := 0; i < len(v); i++ {
+		elems := strings.Split(v[i], ",")
+		for j := 0; j < len(elems); j++ {
+			pairs := strings.Split(elems[j], ";")
+			for k := 0; k < len(pairs); k++ {
+				kv := strings.SplitN(strings.TrimSpace(pairs[k]), "=", 2)
+				if len(kv) != 2 || strings.ToLower(kv[0]) != "for" {
+					continue
+				}
+				hops = append(hops, strings.Trim(kv[1], `"`))
+			}
+		}
+	}
+
+	return hops
+}
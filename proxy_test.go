@@ -0,0 +1,123 @@
+package webconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	if err := c.Set("HTTP", "trusted-proxies", "10.0.0.0/8, 2001:db8:ffff::/48"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string][]string
+		ip         string
+	}{
+		{"no proxy", "198.51.100.7:5000", nil, "198.51.100.7"},
+		{"spoofed xff", "198.51.100.7:5000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, "198.51.100.7"},
+		{"spoofed forwarded", "198.51.100.7:5000",
+			map[string][]string{"Forwarded": {"for=1.2.3.4"}}, "198.51.100.7"},
+		{"spoofed x-real-ip", "198.51.100.7:5000",
+			map[string][]string{"X-Real-Ip": {"1.2.3.4"}}, "198.51.100.7"},
+		{"xff", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9"},
+
+		// Right to left; the client may prepend anything.
+		{"xff trusted hops", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.9, 10.0.0.3, 10.0.0.2"}}, "203.0.113.9"},
+		{"xff headers", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.9", "10.0.0.2"}}, "203.0.113.9"},
+		{"xff all trusted", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"xff port", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"203.0.113.9:4711"}}, "203.0.113.9"},
+
+		// RFC 7239; it takes precedence over X-Forwarded-For.
+		{"forwarded", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"for=203.0.113.9;proto=https"}, "X-Forwarded-For": {"1.2.3.4"}}, "203.0.113.9"},
+		{"forwarded hops", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"for=1.2.3.4, for=203.0.113.9;by=10.0.0.2, For=10.0.0.2"}}, "203.0.113.9"},
+		{"forwarded ipv6", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"forwarded ipv6 trusted", "[2001:db8:ffff::1]:443",
+			map[string][]string{"Forwarded": {`for="[2001:db8:cafe::17]", for="[2001:db8:ffff::2]"`}}, "2001:db8:cafe::17"},
+		{"forwarded ipv4 quoted", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {`for="203.0.113.9:80"`}}, "203.0.113.9"},
+
+		{"x-real-ip", "10.0.0.1:5000",
+			map[string][]string{"X-Real-Ip": {"203.0.113.9"}}, "203.0.113.9"},
+		{"x-real-ip invalid", "10.0.0.1:5000",
+			map[string][]string{"X-Real-Ip": {"localhost"}}, "10.0.0.1"},
+
+		// Malformed; the last valid hop is the client.
+		{"xff garbage", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"not-an-ip"}}, "10.0.0.1"},
+		{"xff garbage left", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {"<script>, 10.0.0.2"}}, "10.0.0.2"},
+		{"xff blank items", "10.0.0.1:5000",
+			map[string][]string{"X-Forwarded-For": {" , ,203.0.113.9,"}}, "203.0.113.9"},
+		{"forwarded obfuscated", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"for=_hidden, for=10.0.0.2"}}, "10.0.0.2"},
+		{"forwarded unknown", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"forwarded no for", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"proto=https;by=10.0.0.1"}, "X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.9"},
+		{"forwarded no value", "10.0.0.1:5000",
+			map[string][]string{"Forwarded": {"for"}}, "10.0.0.1"},
+		{"invalid peer", "garbage", nil, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.header {
+			for i := 0; i < len(v); i++ {
+				r.Header.Add(k, v[i])
+			}
+		}
+		if got := c.ClientIP(r); got != tt.ip {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.ip)
+		}
+	}
+}
+
+func TestForwardedHops(t *testing.T) {
+	tests := []struct {
+		header string
+		hops   string
+	}{
+		{"for=192.0.2.43", "192.0.2.43"},
+		{`for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https`, "192.0.2.43 [2001:db8:cafe::17]:4711"},
+		{"proto=http;for=192.0.2.60;by=203.0.113.43", "192.0.2.60"},
+		{"For=192.0.2.43;FOR=192.0.2.44", "192.0.2.43 192.0.2.44"},
+		{"by=10.0.0.1", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		h.Set("Forwarded", tt.header)
+		got := forwardedHops(h)
+		if strings.Join(got, " ") != tt.hops {
+			t.Errorf("%q: got %q; want %q", tt.header, got, tt.hops)
+		}
+	}
+}
+
+func TestXForwardedForHops(t *testing.T) {
+	h := http.Header{}
+	h.Add("X-Forwarded-For", "203.0.113.9, 10.0.0.3")
+	h.Add("X-Forwarded-For", " ,10.0.0.2 ")
+	if got := xForwardedForHops(h); strings.Join(got, " ") != "203.0.113.9 10.0.0.3 10.0.0.2" {
+		t.Errorf("got %q; want [203.0.113.9 10.0.0.3 10.0.0.2]", got)
+	}
+	if got := xForwardedForHops(http.Header{}); got != nil {
+		t.Errorf("got %q; want none", got)
+	}
+}
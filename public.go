@@ -3,24 +3,24 @@ package webconfig
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"os"
 	"strings"
-
-	"github.com/kambahr/go-mathsets"
 )
 
 // Refresh is the same as GetConfig. It reads the config from disk
-// and fills-in the build-in fields accordingly.
+// into a new snapshot; see Snapshot.
 func (c *Config) Refresh() {
 	c.GetConfig()
 }
 
-// GetJSON returns json of the Config struct.
+// GetJSON returns json of the Config struct; the values are
+// of the current snapshot. Secret values of the Data section are
+// redacted; see EncryptValue.
 func (c *Config) GetJSON() string {
-	b, err := json.Marshal(&c)
+	b, err := json.Marshal(c.redactedSnapshot())
 	if err != nil {
 		fmt.Println(err)
 		return ""
@@ -34,220 +34,169 @@ func (c *Config) GetJSON() string {
 	return s
 }
 
-// hasSection check for the line(s) above to see if there
-// a section.
-func (c *Config) hasSection(lines []string, pos int) bool {
-
-	x := pos - 1
-	for {
-		if x < 1 {
-			break
-		}
-		l := strings.Trim(lines[x], " ")
-		if c.skipLine(l) {
-			x--
-			continue
-		}
-		v := strings.Split(l, " ")
-		if len(v) < 2 {
-			return true
-		}
-		x--
-	}
-
-	return false
-}
-
-// getData fills-in the Data section of the config.
-func (c *Config) getData(line []string) {
-
-	inx := -1
-	for i := 0; i < len(line); i++ {
-		l := strings.Trim(line[i], " ")
-		if c.skipLine(l) || l == "" {
-			continue
-		}
-		if strings.HasPrefix(strings.ToLower(l), "data") {
-			inx = i
-			break
-		}
-	}
-
-	if inx < 0 {
-		// Data section was not found
-		return
-	}
-
-	// Go forward one
-	inx++
-
-	// Get the count of the map
-	dataCount := 0
-	for i := inx; i < len(line); i++ {
-		l := strings.Trim(line[i], " ")
-		if c.skipLine(l) || l == "" {
-			continue
-		}
-		dataCount++
-	}
-
-	// Split each line: as left/right (key/vlaue) and append to the Data map
-	c.Data = make(map[string]string, dataCount)
-	for i := inx; i < len(line); i++ {
-		l := strings.Trim(line[i], " ")
-		if c.skipLine(l) || l == "" {
-			continue
-		}
-		v := strings.Split(line[i], " ")
-		key := v[0]
-		val := ""
-		// account for multi-spaces between key and value.
-		for j := 1; j < len(v); j++ {
-			if v[j] != "" {
-				val = fmt.Sprintf("%s %s", val, v[j])
-			}
-		}
-		c.Data[key] = val
-	}
-}
-
 // GetConfig reads config values from file /appdata/.cfg.
 // All values are part of a struct so lingering text in the config
-// file will not be processed.
+// file will not be processed. The values are placed in a new snapshot
+// that replaces the current one at once; see Snapshot. The fields of
+// c are updated as well.
+// The process exits if the file cannot be read; see GetConfigE.
+// If the file has errors the previous values are kept and the
+// errors are logged; see WithInvalidConfigPolicy.
 func (c *Config) GetConfig() {
-
-	f, err := ReadFile(c.ConfigFilePath)
+	err := c.GetConfigE()
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// do not process, if the file has not changed.
-	hs := fmt.Sprintf("%x", mathsets.Hash256Twice(f))
-	if hs == c.ConfigFileLastHash {
-		return
-	}
-	c.ConfigFileLastHash = hs
-
-	linex := strings.Split(string(f), "\n")
-	var line []string
-
-	// Begin with a blank line. If the frist section is on the first line,
-	// it may be skipped.
-	if len(linex) > 0 && linex[0] != "" && linex[0] != "#" {
-		line = append(line, "")
-	}
+// GetConfigE is the same as GetConfig; it returns the error instead
+// of exiting. The current config values are kept on error; a
+// *ValidationError is returned if the file has values that cannot
+// be used.
+func (c *Config) GetConfigE() error {
+	c = c.root()
+	rt := c.state()
 
-	// Put the continuation of lines together.
-	// Also remove tabs and trime lines.
-	for i := 0; i < len(linex); i++ {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
 
-		linex[i] = c.trimLine(linex[i])
+	return c.load()
+}
 
-		if strings.HasSuffix(linex[i], "\\") {
-			// this and the next line
-			if (i + 1) >= len(linex) {
-				break
-			}
+// load reads the config file into a new snapshot and applies it;
+// the caller must hold rt.mu.
+func (c *Config) load() error {
+	return c.loadWritten("")
+}
 
-			// Take out the \ at the end
-			linex[i] = linex[i][0 : len(linex[i])-1]
+// loadWritten is load after the config file has been written by
+// Update; replaced is the hash of the content that was replaced. If
+// the config in effect was read from it, the new content is applied
+// even if it has errors, as the edits did not add any (see Update).
+func (c *Config) loadWritten(replaced string) error {
 
-			linex[i+1] = c.trimLine(linex[i+1])
+	f, err := ReadFile(c.ConfigFilePath)
+	if err != nil {
+		return err
+	}
 
-			s := fmt.Sprintf("%s%s", linex[i], linex[i+1])
-			line = append(line, s)
-			i++
-			continue
+	var fb []byte
+	blockedIPPath := fmt.Sprintf("%s/.cfg/%s", c.AppDataPath, blockedIPFileName)
+	if fileOrDirExists(blockedIPPath) {
+		fb, err = ReadFile(blockedIPPath)
+		if err != nil {
+			return err
 		}
-
-		line = append(line, linex[i])
 	}
 
-	for i := 0; i < len(line); i++ {
-		l := strings.Trim(line[i], " ")
-		if c.skipLine(l) || l == "" {
-			continue
+	var fm []byte
+	if fileOrDirExists(c.maintPagePath()) {
+		fm, err = ReadFile(c.maintPagePath())
+		if err != nil {
+			return err
 		}
+	}
 
-		lLower := strings.ToLower(l)
-
-		if strings.HasPrefix(lLower, "maintenance-window") {
-			s := strings.ToLower(c.parseCofigLine(l, "maintenance-window"))
-
-			if s == "on" {
-				c.MaintenanceWindowOn = true
-			} else {
-				c.MaintenanceWindowOn = false
-			}
-		} else if strings.HasPrefix(lLower, "site") {
-			keys := []string{"hostname", "alternate-hostnames", "portno", "proto"}
-			i++
-			i = c.getConfigLeaves(line, i, "site", keys)
-
-		} else if strings.HasPrefix(lLower, "tls") {
-			keys := []string{"cert", "key"}
-			i++
-			i = c.getConfigLeaves(line, i, "tls", keys)
-
-		} else if strings.HasPrefix(lLower, "admin") {
-			keys := []string{"allowed-ip-addr", "run-on-startup", "portno"}
-			i++
-			i = c.getConfigLeaves(line, i, "admin", keys)
-
-		} else if strings.HasPrefix(lLower, "redirect-http-to-https") {
+	hs := fileHash(f)
+	hb := fileHash(fb)
+	hm := fileHash(fm)
+	rt := c.state()
+	rt.lastReadHash = hs
+
+	// do not process, if the files have not changed (and no struct
+	// has been bound, nor an option set, since; see Bind). If there
+	// are included files, they're known after the file is parsed.
+	cur := c.snapshot()
+	sameOptions := c.ValidateRemoteHost == cur.ValidateRemoteHost &&
+		c.DropBlockedConnections == cur.DropBlockedConnections
+	unchanged := hs == cur.ConfigFileLastHash && hb == cur.blockedIPHash && hm == cur.maintPageHash &&
+		len(rt.bindings) == len(cur.bound) && sameOptions
+	if unchanged && !cur.includesExist() {
+		return nil
+	}
 
-			if strings.ToLower(c.parseCofigLine(l, "redirect-http-to-https")) == "yes" {
-				c.RedirectHTTPtoHTTPS = true
-			} else {
-				c.RedirectHTTPtoHTTPS = false
-			}
+	s := c.newSnapshot()
+	s.ConfigFileLastHash = hs
+	s.blockedIPHash = hb
+	s.maintPageHash = hm
+	s.parse(f)
 
-		} else if strings.HasPrefix(lLower, "messagebanner") {
+	if hs == cur.ConfigFileLastHash && hb == cur.blockedIPHash && hm == cur.maintPageHash &&
+		s.includeHash == cur.includeHash && len(s.bound) == len(cur.bound) && sameOptions {
+		return nil
+	}
+	hash := fmt.Sprintf("%s%s%s%s%d", hs, hb, hm, s.includeHash, len(s.bound))
+	if hash == rt.rejectedHash {
+		return rt.rejectedErr
+	}
 
-			keys := []string{"display-mode", "seconds-to-display"}
-			i++
-			i = c.getConfigLeaves(line, i, "MessageBanner", keys)
+	s.parseBlockedIP(fb)
+	s.parseMaintPage(fm)
+	s.validateSchema()
+	s.diagnostics.sort()
+
+	s.logDiagnostics(cur.diagnostics)
+
+	// Keep the last good config; the one read at start-up is
+	// applied regardless, as there is no other. Only the errors that
+	// the config in effect does not have reject the file (as for
+	// Update); so a file that has errors can still be edited.
+	errs := newErrors(cur.diagnostics, s.diagnostics)
+	if len(errs) > 0 && rt.policy == KeepLastGoodConfig && rt.cur.Load() != nil &&
+		(replaced == "" || replaced != cur.ConfigFileLastHash) {
+		rt.rejectedHash = hash
+		rt.rejectedErr = &ValidationError{Diagnostics: errs}
+		return rt.rejectedErr
+	}
+	rt.rejectedHash = ""
+	rt.rejectedErr = nil
 
-		} else if strings.HasPrefix(lLower, "http") {
+	c.apply(s)
 
-			keys := []string{"allowed-methods"}
-			i++
-			i = c.getConfigLeaves(line, i, "HTTP", keys)
+	return nil
+}
 
-		} else if strings.HasPrefix(lLower, "urlpaths") {
+// parse fills-in the fields from the content of the config file and
+// the files it includes (see readEntries); ${VAR} in the values is
+// expanded and the values can be overridden by environment variables
+// (see EnvVarName).
+func (c *Config) parse(f []byte) {
+	entries := c.readEntries(f)
 
-			keys := []string{"restrict-paths", "exclude-paths", "forward-paths", "conditional-http-service"}
-			i++
-			i = c.getConfigLeaves(line, i, "URLPaths", keys)
-		}
-	}
+	c.expandEnv(entries)
+	entries = append(entries, c.envOverrides(entries)...)
+	c.decryptSecrets(entries)
+	c.entries = entries
 
-	if c.MessageBanner.On && c.MessageBanner.SecondsToDisplay > 0 {
-		c.MessageBanner.TickCount = c.MessageBanner.SecondsToDisplay
-		go c.setTimeoutResetMsgBanner()
-	}
+	c.applyEntries(entries)
+	c.decodeBindings(entries)
+}
 
-	c.getData(line)
+// parseBlockedIP reads the offenders from the content of
+// /appdata/.cfg/blocked-ip.
+func (c *Config) parseBlockedIP(f []byte) {
+	path := fmt.Sprintf("%s/.cfg/%s", c.AppDataPath, blockedIPFileName)
 
-	// Get the offenders
-	blockedIPPath := fmt.Sprintf("%s/.cfg/blocked-ip", c.AppDataPath)
-	if fileOrDirExists(blockedIPPath) {
-		f, err := ReadFile(blockedIPPath)
-		if err != nil {
-			log.Fatal(err)
+	line := strings.Split(string(f), "\n")
+	c.BlockedIP = make([]string, 0)
+	c.blockedIP, _ = NewIPMatcher(nil)
+	for i := 0; i < len(line); i++ {
+		l := c.trimLine(line[i])
+		if strings.HasPrefix(l, "#") || l == "" {
+			continue
 		}
-
-		line = strings.Split(string(f), "\n")
-		c.BlockedIP = make([]string, 0)
-		for i := 0; i < len(line); i++ {
-			l := strings.Trim(line[i], " ")
-			if strings.HasPrefix(l, "#") || l == "" {
-				continue
-			}
-			v := strings.Split(l, " ")
-			ip := v[0]
-			c.BlockedIP = append(c.BlockedIP, ip)
+		v := strings.Split(l, " ")
+		ip := v[0]
+		if err := c.blockedIP.Add(ip); err != nil {
+			e := entry{Key: ip, File: path, Line: i + 1, Col: strings.Index(line[i], ip) + 1}
+			c.diagnostics.addf(&e, SeverityWarning, false, "%v", err)
+			continue
 		}
+		c.BlockedIP = append(c.BlockedIP, ip)
 	}
 }
 
@@ -263,84 +212,22 @@ func (c *Config) GetConfig() {
 //	      TLS
 //	         cert /usr/local/mydomain/appdata/tls/certx.pem
 //	         key /usr/local/mydomain/appdata/tls/keyx.pem
+//
+// Only the value is replaced; comments, indentation and blank lines
+// are written back as they were. The key is added if it's not in the
+// file; see Set.
+// The process exits if the file cannot be read or written; see
+// UpdateConfigValueE.
 func (c *Config) UpdateConfigValue(parent string, key string, newValue string) {
-
-	f, err := ReadFile(c.ConfigFilePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	key = strings.ToLower(key)
-	line := strings.Split(string(f), "\n")
-
-	for i := 0; i < len(line); i++ {
-		line[i] = strings.Replace(line[i], "\t", " ", -1)
-		line[i] = strings.TrimLeft(line[i], " ")
-		line[i] = strings.TrimRight(line[i], " ")
-
-		if c.skipLine(line[i]) {
-			continue
-		}
-		l := strings.ToLower(line[i])
-		if strings.HasPrefix(l, strings.ToLower(parent)) {
-			for {
-				i++
-				line[i] = strings.Replace(line[i], "\t", " ", -1)
-				line[i] = strings.TrimLeft(line[i], " ")
-				line[i] = strings.TrimRight(line[i], " ")
-				if i >= len(line) {
-					break
-				}
-				if c.skipLine(line[i]) {
-					continue
-				}
-				l = strings.ToLower(line[i])
-				if strings.HasPrefix(l, key) {
-					line[i] = fmt.Sprintf("   %s      %s", key, newValue)
-					goto lblDone
-				}
-			}
-		}
-	}
-lblDone:
-	// Write the lines to disk
-	fPath := fmt.Sprintf("%s/.cfg/.all.swap", c.AppDataPath)
-
-	fx, err := os.Create(fPath)
-	if err != nil {
+	if err := c.UpdateConfigValueE(parent, key, newValue); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	// Remove extra lines
-	var line2 []string
-	count := len(line)
-	for i := 0; i < count; i++ {
-		line[i] = strings.Trim(line[i], " ")
-		if line[i] == "" {
-			if (i + 1) >= count {
-				break
-			}
-			if line[i+1] == "" {
-				continue
-			}
-		}
-		line2 = append(line2, line[i])
-	}
-
-	for i := 0; i < len(line2); i++ {
-		s := fmt.Sprintf("%s\n", line2[i])
-		fx.WriteString(s)
-	}
-	err = fx.Close()
-	if err == nil {
-		// replace the file
-		err = os.Rename(fPath, c.ConfigFilePath)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}
-
-	// Refresh
-	c.GetConfig()
+// UpdateConfigValueE is the same as UpdateConfigValue; it returns
+// the error instead of exiting.
+func (c *Config) UpdateConfigValueE(parent string, key string, newValue string) error {
+	return c.Set(parent, key, newValue)
 }
 
 //--------------------------------------------------------------
@@ -350,16 +237,29 @@ lblDone:
 // Use /* */ blocks to insert comments anywhere inside a JSON block.
 // In addition to the raw format, map[string]interface{}, the content
 // of the file is returned, in []byte (to unmarshall into a specific type).
+// The process exits if the file cannot be read; see LoadJSONConfigE.
 func LoadJSONConfig(path string) (map[string]interface{}, []byte) {
+	m, b, err := LoadJSONConfigE(path)
+	if err != nil && b == nil {
+		log.Fatal(err.Error())
+	}
+
+	return m, b
+}
+
+// LoadJSONConfigE is the same as LoadJSONConfig; it returns the
+// error instead of exiting. If the file was read, but its content
+// is not valid JSON, the content is returned along with the error.
+func LoadJSONConfigE(path string) (map[string]interface{}, []byte, error) {
 	var jsonStrArry string
 
 	if !fileOrDirExists(path) {
-		log.Fatal("config file does not exist")
+		return nil, nil, errors.New("config file does not exist")
 	}
 
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal(err.Error())
+		return nil, nil, err
 	}
 	str := string(b)
 	lines := strings.Split(str, "\n")
@@ -393,9 +293,11 @@ func LoadJSONConfig(path string) (map[string]interface{}, []byte) {
 	b = bytes.ReplaceAll(b, []byte(`\"`), []byte(`"`))
 
 	var m map[string]interface{}
-	json.Unmarshal(b, &m)
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, b, err
+	}
 
-	return m, b
+	return m, b, nil
 }
 
 // RemovePhraseFromString removes a phrase from a string.
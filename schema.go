@@ -0,0 +1,189 @@
+package webconfig
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// httpMethods are the valid values of allowed-methods.
+var httpMethods = []string{
+	"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE",
+}
+
+// ValidationError is returned when the config file has values that
+// cannot be used (see Diagnostics). On reload the previous config is
+// kept in effect (see WithInvalidConfigPolicy); on Update nothing is
+// written if the edits add the errors (see ErrNotApplied).
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	var errs []string
+	for i := 0; i < len(e.Diagnostics); i++ {
+		if e.Diagnostics[i].Severity == SeverityError {
+			errs = append(errs, e.Diagnostics[i].String())
+		}
+	}
+	return fmt.Sprintf("invalid config (%d errors): %s", len(errs), strings.Join(errs, "; "))
+}
+
+// check returns the diagnostics of the content of a config file.
+func (c *Config) check(f []byte) diagList {
+	s := c.newSnapshot()
+	s.parse(f)
+	s.validateSchema()
+	s.diagnostics.sort()
+
+	return s.diagnostics
+}
+
+// newErrors returns the errors in after that are not in before;
+// they're compared by section, key and message as the lines may
+// have moved.
+func newErrors(before []Diagnostic, after []Diagnostic) []Diagnostic {
+	type id struct{ section, key, msg string }
+	seen := make(map[id]bool)
+	for i := 0; i < len(before); i++ {
+		seen[id{before[i].Section, before[i].Key, before[i].Message}] = true
+	}
+
+	var list []Diagnostic
+	for i := 0; i < len(after); i++ {
+		d := after[i]
+		if d.Severity == SeverityError && !seen[id{d.Section, d.Key, d.Message}] {
+			list = append(list, d)
+		}
+	}
+	return list
+}
+
+// validateSchema checks the values that were read from the config
+// file; the problems are added to the diagnostics as errors. The
+// conversion errors (i.e. a portno that is not a number) have already
+// been reported by the parser.
+func (c *Config) validateSchema() {
+	// Site
+	if c.Site.PortNo < 1 || c.Site.PortNo > 65535 {
+		c.schemaErrorf("Site", "portno", "port number %d is out of range (1-65535)", c.Site.PortNo)
+	}
+	if c.Site.Proto != "http" && c.Site.Proto != "https" {
+		c.schemaErrorf("Site", "proto", "invalid proto %q; expected http or https", c.Site.Proto)
+	}
+
+	// Admin; zero means that the admin website is not served
+	// on a port of its own.
+	if c.Admin.PortNo > 65535 {
+		c.schemaErrorf("Admin", "portno", "port number %d is out of range (0-65535)", c.Admin.PortNo)
+	}
+
+	// HTTP
+	if len(c.HTTP.AllowedMethods) == 0 {
+		c.schemaErrorf("HTTP", "allowed-methods", "no methods are allowed; all requests would be rejected")
+	}
+	for i := 0; i < len(c.HTTP.AllowedMethods); i++ {
+		m := c.HTTP.AllowedMethods[i]
+		if !isHTTPMethod(m) {
+			if isHTTPMethod(strings.ToUpper(m)) {
+				c.schemaErrorf("HTTP", "allowed-methods", "method %q must be upper-case", m)
+				continue
+			}
+			c.schemaErrorf("HTTP", "allowed-methods", "invalid method %q", m)
+		}
+	}
+
+	// URL paths
+	c.validatePaths("URLPaths", "restrict-paths", c.URLPaths.Restrict)
+	c.validatePaths("URLPaths", "exclude-paths", c.URLPaths.Exclude)
+	c.validatePaths("Maintenance", "bypass-paths", c.Maintenance.BypassPaths)
+	for i := 0; i < len(c.URLPaths.ServeOnlyTo); i++ {
+		svc := c.URLPaths.ServeOnlyTo[i]
+		if !strings.HasPrefix(svc.URLPath, "/") {
+			c.schemaErrorf("URLPaths", "conditional-http-service", "url-path %q must begin with /", svc.URLPath)
+		}
+		switch svc.RuleType {
+		case CondHTTPSvc_Header, CondHTTPSvc_IPAddress, CondHTTPSvc_QueryString:
+		default:
+			c.schemaErrorf("URLPaths", "conditional-http-service", "invalid rule-type %q; expected %s, %s or %s",
+				svc.RuleType, CondHTTPSvc_Header, CondHTTPSvc_IPAddress, CondHTTPSvc_QueryString)
+		}
+	}
+
+	// Maintenance
+	if c.Maintenance.RetryAfter < 0 {
+		c.schemaErrorf("Maintenance", "retry-after", "retry-after cannot be negative")
+	}
+	if !c.Maintenance.Start.IsZero() && !c.Maintenance.End.IsZero() && !c.Maintenance.End.After(c.Maintenance.Start) {
+		c.schemaErrorf("Maintenance", "end", "end must be after start")
+	}
+
+	// MessageBanner
+	if c.MessageBanner.SecondsToDisplay < 0 {
+		c.schemaErrorf("MessageBanner", "seconds-to-display", "seconds-to-display cannot be negative")
+	}
+
+	// TLS
+	c.validatePEMFile("cert", c.TLS.CertFilePath, "CERTIFICATE")
+	c.validatePEMFile("key", c.TLS.KeyFilePath, "PRIVATE KEY")
+	if (c.TLS.CertFilePath == "") != (c.TLS.KeyFilePath == "") {
+		c.schemaErrorf("TLS", "cert", "cert and key must be set together")
+	}
+}
+
+// validatePaths checks that each path is relative to the site.
+func (c *Config) validatePaths(section string, key string, paths []string) {
+	for i := 0; i < len(paths); i++ {
+		if !strings.HasPrefix(paths[i], "/") {
+			c.schemaErrorf(section, key, "path %q must begin with /", paths[i])
+		}
+	}
+}
+
+// validatePEMFile checks that path (if set) is a PEM file with a
+// block of the type that ends with blockType; i.e. RSA PRIVATE KEY
+// for PRIVATE KEY.
+func (c *Config) validatePEMFile(key string, path string, blockType string) {
+	if path == "" {
+		return
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		c.schemaErrorf("TLS", key, "%v", err)
+		return
+	}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if strings.HasSuffix(block.Type, blockType) {
+			return
+		}
+	}
+	c.schemaErrorf("TLS", key, "%s is not a PEM file with a %s", path, blockType)
+}
+
+// schemaErrorf adds an error about section.key; the position is of
+// the (last) entry of the key in the config file.
+func (c *Config) schemaErrorf(section string, key string, format string, a ...interface{}) {
+	e := entry{Section: section, Key: key, File: c.ConfigFilePath}
+	for i := len(c.entries) - 1; i > -1; i-- {
+		if strings.EqualFold(c.entries[i].Section, section) && c.entries[i].Key == key {
+			e = c.entries[i]
+			break
+		}
+	}
+	c.diagnostics.addf(&e, SeverityError, e.Line > 0, format, a...)
+}
+
+func isHTTPMethod(m string) bool {
+	for i := 0; i < len(httpMethods); i++ {
+		if httpMethods[i] == m {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package webconfig
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// secretPrefix marks an encrypted value; i.e.
+	//
+	//	Data
+	//	   db-conn  enc:3q2+7w...
+	//
+	// The value is decrypted when the config is read; see
+	// EncryptValue.
+	secretPrefix = "enc:"
+
+	// secretKeyEnv holds the key (base64) and secretKeyFileEnv the
+	// path of the key file; otherwise the key is read from
+	// /appdata/.cfg/secret.key.
+	secretKeyEnv      = "WEBCONFIG_SECRET_KEY"
+	secretKeyFileEnv  = "WEBCONFIG_SECRET_KEY_FILE"
+	secretKeyFileName = "secret.key"
+
+	// redacted replaces the secret values in GetJSON, Sources and
+	// the log.
+	redacted = "[redacted]"
+)
+
+var errNoSecretKey = errors.New("no key to decrypt the value; set " + secretKeyEnv + " or create " + secretKeyFileName)
+
+// secretKeyNames are the words of the key names that hold secrets
+// in plain text; their values are redacted, too. A key matches by
+// whole words, separated by - or _; i.e. db-password and api_key,
+// but not tokenizer-mode.
+var secretKeyNames = []string{"password", "passwords", "passwd", "pwd", "secret", "secrets", "token", "tokens",
+	"api-key", "apikey", "private-key", "credential", "credentials"}
+
+// urlPassword matches the password of a url (scheme://user:password@)
+// and connPassword the one of a connection string (password=...;).
+var (
+	urlPassword  = regexp.MustCompile(`(://[^:/@\s]*):[^@\s]*@`)
+	connPassword = regexp.MustCompile(`(?i)\b((?:password|pwd)\s*=\s*)[^;\s]*`)
+)
+
+// EncryptValue encrypts value with the key of the config (AES-256-GCM)
+// and returns it in the form that can be placed in the config file;
+// i.e. enc:3q2+7w... The key is taken from WEBCONFIG_SECRET_KEY (base64),
+// the file in WEBCONFIG_SECRET_KEY_FILE or /appdata/.cfg/secret.key;
+// the latter is created if there is no key.
+//
+// The values are decrypted when the config is read. GetJSON, Sources
+// and the diagnostics redact them, and the values of keys named like
+// secrets (i.e. db-password); Snapshot, DataValue, DataSection and
+// the structs of Bind have them in plain text.
+func (c *Config) EncryptValue(value string) (string, error) {
+	key, err := c.secretKey(true)
+	if err != nil {
+		return "", err
+	}
+	return encryptValue(key, value)
+}
+
+// SetSecret encrypts value (see EncryptValue) and sets it as the
+// value of key in section; see Set.
+func (c *Config) SetSecret(section string, key string, value string) error {
+	v, err := c.EncryptValue(value)
+	if err != nil {
+		return err
+	}
+	return c.Set(section, key, v)
+}
+
+// secretKeyPath returns the path of the key file.
+func (c *Config) secretKeyPath() string {
+	if p := os.Getenv(secretKeyFileEnv); p != "" {
+		return p
+	}
+	return fmt.Sprintf("%s/.cfg/%s", c.AppDataPath, secretKeyFileName)
+}
+
+// secretKey returns the key of the encrypted values; if create is
+// true and there is none, a new key file is written (readable only
+// by the owner).
+func (c *Config) secretKey(create bool) ([]byte, error) {
+	if s := os.Getenv(secretKeyEnv); s != "" {
+		return decodeSecretKey(s, secretKeyEnv)
+	}
+
+	path := c.secretKeyPath()
+	b, err := os.ReadFile(path)
+	if err == nil {
+		return decodeSecretKey(string(b), path)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !create {
+		return nil, errNoSecretKey
+	}
+
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	// O_EXCL; another process may have created it meanwhile.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return c.secretKey(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// decodeSecretKey decodes the base64 key of a 256-bit key; from is
+// where it was read.
+func decodeSecretKey(s string, from string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s: the key must be 32 bytes in base64", from)
+	}
+	return key, nil
+}
+
+// encryptValue returns the enc: form of value.
+func encryptValue(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	b := gcm.Seal(nonce, nonce, []byte(value), nil)
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// decryptValue returns the value of the enc: form v.
+func decryptValue(key []byte, v string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(v, secretPrefix))
+	if err != nil {
+		return "", errors.New("the encrypted value is not valid base64")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < gcm.NonceSize() {
+		return "", errors.New("the encrypted value is too short")
+	}
+	p, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("the value cannot be decrypted; wrong key or the value was altered")
+	}
+	return string(p), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptSecrets decrypts the enc: values of the entries; the key is
+// read once. Values that cannot be decrypted are blank and reported.
+func (c *Config) decryptSecrets(entries []entry) {
+	var key []byte
+	var keyErr error
+
+	for i := 0; i < len(entries); i++ {
+		e := &entries[i]
+		if !strings.HasPrefix(e.Value, secretPrefix) {
+			continue
+		}
+		e.Secret = true
+
+		if key == nil && keyErr == nil {
+			key, keyErr = c.secretKey(false)
+		}
+		if keyErr != nil {
+			c.diagnostics.addf(e, SeverityError, true, "%v", keyErr)
+			e.Value = ""
+			continue
+		}
+		v, err := decryptValue(key, e.Value)
+		if err != nil {
+			c.diagnostics.addf(e, SeverityError, true, "%v", err)
+		}
+		e.Value = v
+	}
+
+	c.secrets = make(map[string]bool)
+	for i := 0; i < len(entries); i++ {
+		if entries[i].isSecret() {
+			c.secrets[strings.ToLower(entries[i].Section)+"."+entries[i].Key] = true
+		}
+	}
+}
+
+// isSecret tells if the value of e is to be redacted; it was
+// encrypted or the key name tells it's a secret.
+func (e *entry) isSecret() bool {
+	return e.Secret || isSecretKey(e.Key)
+}
+
+// shown returns the value of e as it can be logged.
+func (e *entry) shown() string {
+	if e.isSecret() {
+		return redacted
+	}
+	return redactValue(e.Value)
+}
+
+// isSecretKey tells if the key name has one of secretKeyNames.
+func isSecretKey(key string) bool {
+	key = "-" + strings.ReplaceAll(strings.ToLower(key), "_", "-") + "-"
+	for i := 0; i < len(secretKeyNames); i++ {
+		if strings.Contains(key, "-"+secretKeyNames[i]+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue redacts the passwords of the urls and connection
+// strings in v.
+func redactValue(v string) string {
+	v = urlPassword.ReplaceAllString(v, "$1:"+redacted+"@")
+	return connPassword.ReplaceAllString(v, "${1}"+redacted)
+}
+
+// redactedSnapshot returns a copy of the snapshot with the secret
+// values redacted; see GetJSON.
+func (c *Config) redactedSnapshot() *Config {
+	s := c.snapshot()
+	r := s.newSnapshot()
+	r.mirror(s)
+
+	if s.Data != nil {
+		r.Data = make(map[string]string, len(s.Data))
+		for k, v := range s.Data {
+			if s.secrets[strings.ToLower(dataSection)+"."+k] || isSecretKey(k) {
+				v = redacted
+			} else {
+				v = redactValue(v)
+			}
+			r.Data[k] = v
+		}
+	}
+	return r
+}
@@ -0,0 +1,230 @@
+package webconfig
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptValue(t *testing.T) {
+	key := newTestKey(t)
+
+	for _, v := range []string{"", "s3cret", "multi\nline ünicode", strings.Repeat("x", 4096)} {
+		enc, err := encryptValue(key, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(enc, secretPrefix) || (v != "" && strings.Contains(enc, v)) {
+			t.Fatalf("encryptValue(%q) = %q", v, enc)
+		}
+		got, err := decryptValue(key, enc)
+		if err != nil || got != v {
+			t.Errorf("decryptValue(encryptValue(%q)) = %q, %v", v, got, err)
+		}
+	}
+
+	enc1, _ := encryptValue(key, "same")
+	enc2, _ := encryptValue(key, "same")
+	if enc1 == enc2 {
+		t.Error("the nonce is reused")
+	}
+
+	b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(enc1, secretPrefix))
+	b[len(b)-1] ^= 1
+	altered := secretPrefix + base64.StdEncoding.EncodeToString(b)
+
+	tests := []struct {
+		name string
+		key  []byte
+		v    string
+		err  string
+	}{
+		{"wrong key", newTestKey(t), enc1, "wrong key or the value was altered"},
+		{"altered", key, altered, "wrong key or the value was altered"},
+		{"not base64", key, "enc:%%%", "not valid base64"},
+		{"too short", key, "enc:" + base64.StdEncoding.EncodeToString([]byte("short")), "too short"},
+	}
+	for _, tt := range tests {
+		if _, err := decryptValue(tt.key, tt.v); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v; want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeSecretKey(t *testing.T) {
+	key := newTestKey(t)
+	s := base64.StdEncoding.EncodeToString(key)
+
+	if got, err := decodeSecretKey(s+"\n", "test"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(key[:16])} {
+		if _, err := decodeSecretKey(s, "test"); err == nil {
+			t.Errorf("decodeSecretKey(%q): no error", s)
+		}
+	}
+}
+
+func TestIsSecretKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"password", true},
+		{"db-password", true},
+		{"DB_PASSWORD", true},
+		{"smtp-pwd", true},
+		{"api-key", true},
+		{"x_api_key", true},
+		{"apikey", true},
+		{"client-secret", true},
+		{"access-token", true},
+		{"aws-credentials", true},
+		{"tokenizer-mode", false},
+		{"secretary-email", false},
+		{"pwdless-login", false},
+		{"api-keyboard", false},
+		{"hostname", false},
+	}
+	for _, tt := range tests {
+		if got := isSecretKey(tt.key); got != tt.want {
+			t.Errorf("isSecretKey(%q) = %v; want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"postgres://app:s3cret@db:5432/app", "postgres://app:" + redacted + "@db:5432/app"},
+		{"Server=db;User Id=app;Password=s3cret;", "Server=db;User Id=app;Password=" + redacted + ";"},
+		{"host=db pwd=s3cret", "host=db pwd=" + redacted},
+		{"https://example.com/a:b", "https://example.com/a:b"},
+		{"plain value", "plain value"},
+	}
+	for _, tt := range tests {
+		if got := redactValue(tt.in); got != tt.want {
+			t.Errorf("redactValue(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	t.Setenv(secretKeyEnv, base64.StdEncoding.EncodeToString(newTestKey(t)))
+	c := newTestConfig(t)
+
+	if err := c.SetSecret("Data", "db-conn", "postgres://app:s3cret@db/app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("Data", "smtp-password", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(c.ConfigFilePath)
+	if strings.Contains(string(b), "s3cret") || !strings.Contains(string(b), "db-conn") {
+		t.Fatalf("the secret is not encrypted in the file:\n%s", b)
+	}
+
+	// Plain text
+	if v, _ := c.DataValue("db-conn"); v != "postgres://app:s3cret@db/app" {
+		t.Errorf("DataValue: got %q", v)
+	}
+	if v := c.DataSection().GetString("db-conn", ""); v != "postgres://app:s3cret@db/app" {
+		t.Errorf("DataSection: got %q", v)
+	}
+
+	// Redacted
+	js := c.GetJSON()
+	if strings.Contains(js, "s3cret") || strings.Contains(js, "plain") {
+		t.Errorf("GetJSON has the secrets:\n%s", js)
+	}
+	for _, src := range c.Sources() {
+		if src.Key == "db-conn" || src.Key == "smtp-password" {
+			if src.Value != redacted || !src.Secret {
+				t.Errorf("Sources: %s = %q", src.Key, src.Value)
+			}
+		}
+	}
+
+	// WriteTo encrypts the value again.
+	var buf bytes.Buffer
+	if _, err := c.Snapshot().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "s3cret") {
+		t.Error("WriteTo wrote the secret in plain text")
+	}
+
+	// The wrong key; the value is blank and reported.
+	t.Setenv(secretKeyEnv, base64.StdEncoding.EncodeToString(newTestKey(t)))
+	c2 := newTestConfig(t, WithInvalidConfigPolicy(ApplyInvalidConfig))
+	s := readTestConfig(t, c2, string(b))
+	if v, _ := s.DataValue("db-conn"); v != "" {
+		t.Errorf("got %q with the wrong key", v)
+	}
+	if !HasErrors(s.Diagnostics()) {
+		t.Error("no error for the wrong key")
+	}
+	for _, d := range s.Diagnostics() {
+		if strings.Contains(d.String(), "s3cret") {
+			t.Errorf("the diagnostic has the secret: %v", d)
+		}
+	}
+}
+
+func TestSecretKeyFile(t *testing.T) {
+	t.Setenv(secretKeyEnv, "")
+	c := newTestConfig(t)
+
+	enc, err := c.EncryptValue("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(c.secretKeyPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("the key file mode is %v", fi.Mode().Perm())
+	}
+
+	key, err := c.secretKey(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := decryptValue(key, enc); err != nil || v != "v" {
+		t.Errorf("got %q, %v", v, err)
+	}
+}
+
+func FuzzEncryptValue(f *testing.F) {
+	key := make([]byte, 32)
+	f.Add("s3cret", "enc:")
+	f.Add("", "enc:AAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+	f.Add("multi\nline", "%%%")
+	f.Fuzz(func(t *testing.T, v string, enc string) {
+		e, err := encryptValue(key, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := decryptValue(key, e); err != nil || got != v {
+			t.Fatalf("decryptValue(encryptValue(%q)) = %q, %v", v, got, err)
+		}
+
+		// Any other value is an error, not a panic.
+		decryptValue(key, enc)
+	})
+}
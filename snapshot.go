@@ -0,0 +1,187 @@
+package webconfig
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runtimeState is kept by the Config returned by NewWebConfig. The
+// config values are read into a new snapshot on every reload; the
+// snapshot is never modified after it's stored, so a request holding
+// one has a consistent view of the config while a reload is in
+// progress.
+type runtimeState struct {
+	cur atomic.Pointer[Config]
+
+	// mu serializes reading the config file with writing to it.
+	mu sync.Mutex
+
+	// stop is closed by Close; wg waits for the goroutines
+	// (file watcher and banner timeout) to exit.
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+
+	// pollInterval is used when the config files are polled; in
+	// nanoseconds. See SetPollInterval.
+	pollInterval atomic.Int64
+
+	// bannerTicks is the count-down of the message banner, in seconds.
+	bannerTicks   atomic.Int64
+	bannerRunning atomic.Bool
+
+	// onError receives the errors of the internal daemon.
+	onError func(error)
+
+	// policy tells whether a config with errors is applied;
+	// rejectedHash is the hash of the files that were last rejected
+	// and rejectedErr the error. reportedErr is the last error that
+	// was passed to onError; so that it's reported once.
+	policy       InvalidConfigPolicy
+	rejectedHash string
+	rejectedErr  error
+	reportedErr  error
+
+	// lastReadHash is the hash of the config file when it was last
+	// read by this process (applied or not); see Config.Update.
+	lastReadHash string
+
+	// format is the format of the config file; see WithFormat. If
+	// it's nil, the format is chosen by the extension.
+	format Format
+
+	// historyLimit is the number of versions kept in the history;
+	// 0 if there is no history, negative if all are kept. See
+	// WithHistoryLimit.
+	historyLimit int
+
+	// bindings are the structs of Bind; bindMu is held while they're
+	// set.
+	bindings []*binding
+	bindMu   sync.RWMutex
+
+	// subs are the subscribers of OnChange and WatchChanges.
+	subs changeSubs
+}
+
+// Snapshot returns the config values that are currently in effect.
+// The returned Config must be treated as read-only; it's replaced
+// (not modified) when the config file changes. Use one snapshot
+// for the whole of a request to get a consistent view, i.e.
+//
+//	cfg := Config.Snapshot()
+//	if cfg.MessageBanner.On { ... }
+//
+// The values are in plain text; encrypted values are decrypted and
+// secrets are not redacted, as they are in GetJSON.
+func (c *Config) Snapshot() *Config {
+	return c.snapshot()
+}
+
+// MessageBannerOn tells if the message banner is to be displayed.
+func (c *Config) MessageBannerOn() bool {
+	return c.snapshot().MessageBanner.On
+}
+
+// MessageBannerTimeLeft returns the time left before display-mode
+// is set back to off; zero if the banner is not on a timeout.
+func (c *Config) MessageBannerTimeLeft() time.Duration {
+	c = c.root()
+	if c.rt == nil || !c.snapshot().MessageBanner.On {
+		return 0
+	}
+	return time.Duration(c.rt.bannerTicks.Load()) * time.Second
+}
+
+// DataValue returns the value of key in the Data section; in plain
+// text, if it was encrypted (see EncryptValue).
+func (c *Config) DataValue(key string) (string, bool) {
+	v, ok := c.snapshot().Data[key]
+	return v, ok
+}
+
+// snapshot returns the current snapshot; a snapshot (or a Config
+// that was not created by NewWebConfig) returns itself.
+func (c *Config) snapshot() *Config {
+	if c.rt == nil {
+		return c
+	}
+	if s := c.rt.cur.Load(); s != nil {
+		return s
+	}
+	return c
+}
+
+// root returns the Config that a snapshot was taken from.
+func (c *Config) root() *Config {
+	if c.origin != nil {
+		return c.origin
+	}
+	return c
+}
+
+// state returns the runtime state; creating it, if the Config was
+// not created by NewWebConfig.
+func (c *Config) state() *runtimeState {
+	if c.rt == nil {
+		c.rt = &runtimeState{}
+	}
+	return c.rt
+}
+
+// newSnapshot creates an empty snapshot with the paths and the
+// options (i.e. ValidateRemoteHost) of c.
+func (c *Config) newSnapshot() *Config {
+	return &Config{
+		origin:                 c,
+		WebRootPath:            c.WebRootPath,
+		AppDataPath:            c.AppDataPath,
+		ConfigFilePath:         c.ConfigFilePath,
+		ConnStat:               c.ConnStat,
+		ValidateRemoteHost:     c.ValidateRemoteHost,
+		DropBlockedConnections: c.DropBlockedConnections,
+	}
+}
+
+// apply makes s the current snapshot; the caller must hold rt.mu.
+func (c *Config) apply(s *Config) {
+	if s.MessageBanner.On && s.MessageBanner.SecondsToDisplay > 0 {
+		s.MessageBanner.TickCount = s.MessageBanner.SecondsToDisplay
+	}
+
+	old := c.rt.cur.Swap(s)
+	c.mirror(s)
+	c.setBindings(s)
+
+	if old != nil {
+		c.publishChange(old, s)
+	}
+
+	if s.MessageBanner.On && s.MessageBanner.SecondsToDisplay > 0 {
+		c.rt.bannerTicks.Store(int64(s.MessageBanner.SecondsToDisplay))
+		if !c.rt.closed && c.rt.bannerRunning.CompareAndSwap(false, true) {
+			c.rt.wg.Add(1)
+			go c.setTimeoutResetMsgBanner()
+		}
+	}
+}
+
+// mirror copies the values of s to the exported fields of c; so
+// that code written before snapshots can read the config. The fields
+// are written on every reload; readers that may run at the same time
+// as a reload must use Snapshot instead.
+func (c *Config) mirror(s *Config) {
+	c.ConfigFileLastHash = s.ConfigFileLastHash
+	c.Admin = s.Admin
+	c.HTTP = s.HTTP
+	c.Site = s.Site
+	c.URLPaths = s.URLPaths
+	c.BlockedIP = s.BlockedIP
+	c.RedirectHTTPtoHTTPS = s.RedirectHTTPtoHTTPS
+	c.MaintenanceWindowOn = s.MaintenanceWindowOn
+	c.Maintenance = s.Maintenance
+	c.MessageBanner = s.MessageBanner
+	c.TLS = s.TLS
+	c.Data = s.Data
+}
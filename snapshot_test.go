@@ -0,0 +1,51 @@
+package webconfig
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSnapshotRace reads the config while it's reloaded; run with
+// -race.
+func TestSnapshotRace(t *testing.T) {
+	c := newTestConfig(t)
+	if c.Site.PortNo != 8085 {
+		t.Fatalf("got portno %d; want 8085", c.Site.PortNo)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s := c.Snapshot()
+				_ = s.Site.PortNo
+				_ = len(s.Data)
+				c.MessageBannerOn()
+			}
+		}()
+	}
+
+	ports := []string{"9001", "9002", "9003"}
+	for i := 0; i < len(ports); i++ {
+		if err := c.Set("Site", "portno", ports[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := c.Snapshot().Site.PortNo; got != 9003 {
+		t.Errorf("got snapshot portno %d; want 9003", got)
+	}
+	if c.Site.PortNo != 9003 {
+		t.Errorf("got portno %d; the fields must be updated on reload", c.Site.PortNo)
+	}
+}
@@ -0,0 +1,227 @@
+package webconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var errTxDone = errors.New("the transaction has already been committed or rolled back")
+
+// Tx is a batch of edits of the config file; see Config.Update. The
+// edits are made in memory and written at once on commit.
+type Tx struct {
+	file   *astFile
+	author string
+	done   bool
+}
+
+// Update calls fn with a Tx to edit the config file. If fn returns
+// nil and the edits do not add errors to the config (see Diagnostics),
+// the file is replaced at once and the config is reloaded, so the
+// edits take effect together. Otherwise nothing is written; if the
+// edits add errors a *ValidationError is returned. A file that has
+// errors already is written if the edits do not add any; it's applied
+// if the config in effect was read from it. Otherwise (the file was
+// rejected; see WithInvalidConfigPolicy) the returned error wraps
+// ErrNotApplied and the *ValidationError. Each change is saved in the
+// history; see Versions and Rollback. The comments and the layout of
+// a file in the free-style format are kept; a file in another format
+// (see WithFormat) is written anew, without comments.
+//
+// e.g.
+//
+//	err := Config.Update(func(tx *webconfig.Tx) error {
+//		if err := tx.Set("", "maintenance-window", "on"); err != nil {
+//			return err
+//		}
+//		return tx.Set("MessageBanner", "display-mode", "on")
+//	})
+//
+// The config file is locked while fn runs, also for other processes
+// (see lockConfig); fn must not call the methods of the Config that
+// edit or read the file. If the file has been changed since this
+// process last read it (i.e. by another process, before the change
+// was picked up), ErrConflict is returned; the config is reloaded,
+// so Update can be called again.
+func (c *Config) Update(fn func(tx *Tx) error) error {
+	return c.update("", fn)
+}
+
+// CompareAndUpdate is the same as Update; it returns ErrConflict if
+// the hash of the config file is not hash; i.e. the ConfigFileLastHash
+// of the snapshot that the edits are based on.
+func (c *Config) CompareAndUpdate(hash string, fn func(tx *Tx) error) error {
+	if hash == "" {
+		return fmt.Errorf("%w: the hash is blank", ErrConflict)
+	}
+	return c.update(hash, fn)
+}
+
+// update is Update and CompareAndUpdate; expect is the hash that
+// the config file must have (blank for the one last read).
+func (c *Config) update(expect string, fn func(tx *Tx) error) error {
+	c = c.root()
+	rt := c.state()
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	unlock, err := c.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	b, err := ReadFile(c.ConfigFilePath)
+	if err != nil {
+		return err
+	}
+
+	if expect == "" {
+		expect = rt.lastReadHash
+	}
+	if expect != "" && fileHash(b) != expect {
+		c.load()
+		return ErrConflict
+	}
+
+	format := c.fileFormat(c.ConfigFilePath)
+	file, err := decodeAST(c.ConfigFilePath, format, b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.ConfigFilePath, err)
+	}
+
+	tx := &Tx{file: file}
+	err = fn(tx)
+	tx.done = true
+	if err != nil {
+		// Roll back; nothing has been written.
+		return err
+	}
+
+	nb, err := encodeAST(format, tx.file)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(b, nb) {
+		return c.load()
+	}
+
+	if errs := newErrors(c.check(b), c.check(nb)); len(errs) > 0 {
+		return &ValidationError{Diagnostics: errs}
+	}
+
+	if err = c.writeConfigFile(nb); err != nil {
+		return err
+	}
+	c.saveVersion(b, nb, tx.author, "")
+
+	// Refresh
+	return c.loadWrittenE(b)
+}
+
+// loadWrittenE reloads the config after b was replaced in the config
+// file; the error of a config that is not applied wraps ErrNotApplied.
+func (c *Config) loadWrittenE(b []byte) error {
+	err := c.loadWritten(fileHash(b))
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return fmt.Errorf("%w: %w", ErrNotApplied, err)
+	}
+	return err
+}
+
+// SetAuthor sets the author of the change in the history; see
+// Versions.
+func (tx *Tx) SetAuthor(author string) {
+	tx.author = author
+}
+
+// Set sets the value of key in section; see Config.Set.
+func (tx *Tx) Set(section string, key string, value string) error {
+	if tx.done {
+		return errTxDone
+	}
+	return tx.file.set(section, key, value)
+}
+
+// Delete removes key from section; see Config.Delete.
+func (tx *Tx) Delete(section string, key string) error {
+	if tx.done {
+		return errTxDone
+	}
+	return tx.file.delete(section, key)
+}
+
+// AddSection adds the header of a section; see Config.AddSection.
+func (tx *Tx) AddSection(name string) error {
+	if tx.done {
+		return errTxDone
+	}
+	return tx.file.addSectionByName(name)
+}
+
+// RemoveSection removes a section with all its keys; see
+// Config.RemoveSection.
+func (tx *Tx) RemoveSection(name string) error {
+	if tx.done {
+		return errTxDone
+	}
+	return tx.file.removeSectionByName(name)
+}
+
+// Get returns the value of key in section, as it is in the
+// transaction.
+func (tx *Tx) Get(section string, key string) (string, bool) {
+	name := section
+	if name == "" && tx.file.findKey("", key) == nil {
+		name = resolveSection(key)
+	}
+	n := tx.file.findKey(name, key)
+	if n == nil {
+		return "", false
+	}
+	return n.value, true
+}
+
+// writeConfigFile replaces the content of the config file. The new
+// content is written to a (uniquely named) file next to it, flushed
+// to disk and then renamed; so the file is never read half-written
+// and a crash leaves either the old or the new file.
+func (c *Config) writeConfigFile(b []byte) error {
+	fx, err := os.CreateTemp(filepath.Dir(c.ConfigFilePath), ".all.*.swap")
+	if err != nil {
+		return err
+	}
+	fPath := fx.Name()
+
+	if err = fx.Chmod(0644); err == nil {
+		_, err = fx.Write(b)
+	}
+	if err == nil {
+		err = fx.Sync()
+	}
+	if cerr := fx.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(fPath)
+		return err
+	}
+
+	if err = os.Rename(fPath, c.ConfigFilePath); err != nil {
+		os.Remove(fPath)
+		return err
+	}
+
+	// Flush the rename; not supported on all platforms.
+	if d, err := os.Open(filepath.Dir(c.ConfigFilePath)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package webconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	c := newTestConfig(t)
+
+	err := c.Update(func(tx *Tx) error {
+		if err := tx.Set("", "maintenance-window", "on"); err != nil {
+			return err
+		}
+		return tx.Set("MessageBanner", "display-mode", "on")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := c.Snapshot(); !s.MaintenanceWindowOn || !s.MessageBanner.On {
+		t.Fatal("the edits were not applied")
+	}
+
+	before, _ := os.ReadFile(c.ConfigFilePath)
+
+	// fn fails; nothing is written.
+	boom := errors.New("boom")
+	err = c.Update(func(tx *Tx) error {
+		tx.Set("Site", "portno", "9000")
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("got %v; want %v", err, boom)
+	}
+
+	// The edits add an error; nothing is written.
+	err = c.Update(func(tx *Tx) error {
+		tx.Set("Site", "hostname", "example.com")
+		return tx.Set("Site", "portno", "0")
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || errors.Is(err, ErrNotApplied) {
+		t.Fatalf("got %v; want a *ValidationError", err)
+	}
+
+	after, _ := os.ReadFile(c.ConfigFilePath)
+	if string(before) != string(after) {
+		t.Fatal("the config file was written")
+	}
+	if s := c.Snapshot(); s.Site.PortNo != 8085 || s.Site.HostName != "localhost" {
+		t.Fatalf("got %s:%d; want the config before the edits", s.Site.HostName, s.Site.PortNo)
+	}
+}
+
+func TestUpdateFileWithErrors(t *testing.T) {
+	// The file has errors at start-up; it's applied, as there is no
+	// other config.
+	root := t.TempDir()
+	cfgDir := filepath.Join(root, "appdata", ".cfg")
+	if err := os.MkdirAll(cfgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	bad := "Site\n   portno 0\n   proto http\nHTTP\n   allowed-methods GET\nMessageBanner\n   display-mode on\n"
+	if err := os.WriteFile(filepath.Join(cfgDir, ".all"), []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewWebConfigE(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if !HasErrors(c.Diagnostics()) {
+		t.Fatal("no errors")
+	}
+
+	// The edit does not add errors; it's written and applied.
+	if err := c.Set("MessageBanner", "display-mode", "off"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Snapshot().MessageBanner.On {
+		t.Fatal("display-mode off was not applied")
+	}
+
+	// A good config is in effect; the file with errors is rejected.
+	if err := c.Set("Site", "portno", "8080"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.ConfigFilePath, []byte(strings.Replace(bad, "8080", "0", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var verr *ValidationError
+	if err := c.GetConfigE(); !errors.As(err, &verr) {
+		t.Fatalf("got %v; want a *ValidationError", err)
+	}
+
+	// The edit is written, but the file is not applied.
+	err = c.Set("Site", "hostname", "example.com")
+	if !errors.Is(err, ErrNotApplied) || !errors.As(err, &verr) {
+		t.Fatalf("got %v; want ErrNotApplied", err)
+	}
+	b, _ := os.ReadFile(c.ConfigFilePath)
+	if !strings.Contains(string(b), "hostname example.com") {
+		t.Fatal("the edit was not written")
+	}
+	if s := c.Snapshot(); s.Site.PortNo != 8080 || s.Site.HostName == "example.com" {
+		t.Fatalf("got %s:%d; want the last good config", s.Site.HostName, s.Site.PortNo)
+	}
+}
+
+// TestReloadFileWithErrors edits a file that has errors by hand; the
+// reload is rejected only if the edit adds errors.
+func TestReloadFileWithErrors(t *testing.T) {
+	root := t.TempDir()
+	cfgDir := filepath.Join(root, "appdata", ".cfg")
+	if err := os.MkdirAll(cfgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	bad := "Site\n   portno 0\n   proto http\nHTTP\n   allowed-methods GET\nMessageBanner\n   display-mode on\n"
+	path := filepath.Join(cfgDir, ".all")
+	if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewWebConfigE(root, WithPolling(), WithPollInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The error of portno is in effect already.
+	edited := strings.Replace(bad, "display-mode on", "display-mode off", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetConfigE(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Snapshot().MessageBanner.On {
+		t.Fatal("display-mode off was not applied")
+	}
+
+	// The edit adds an error; only it is reported.
+	if err := os.WriteFile(path, []byte(strings.Replace(edited, "proto http", "proto ftp", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var verr *ValidationError
+	if err := c.GetConfigE(); !errors.As(err, &verr) {
+		t.Fatalf("got %v; want a *ValidationError", err)
+	}
+	if len(verr.Diagnostics) != 1 || verr.Diagnostics[0].Key != "proto" {
+		t.Errorf("got %v; want the error of proto", verr.Diagnostics)
+	}
+	if c.Snapshot().Site.Proto != "http" {
+		t.Error("the file with the new error was applied")
+	}
+}
@@ -1,9 +1,12 @@
 package webconfig
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"strings"
+
+	"github.com/kambahr/go-mathsets"
 )
 
 // trimLine take out tab and spaces from both end of a linc.
@@ -17,6 +20,20 @@ func (c *Config) trimLine(l string) string {
 	return l
 }
 
+// splitList splits a comma separated value and trims the items;
+// blank items are left out.
+func splitList(s string) []string {
+	v := strings.Split(s, ",")
+	list := make([]string, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		x := strings.Trim(v[i], " ")
+		if x != "" {
+			list = append(list, x)
+		}
+	}
+	return list
+}
+
 // fileOrDirExists checks existance of file or directory.
 func fileOrDirExists(path string) bool {
 	if path == "" {
@@ -84,3 +101,9 @@ func ReadFile(name string) ([]byte, error) {
 		}
 	}
 }
+
+// fileHash returns the hash of the content of a file; as in
+// ConfigFileLastHash.
+func fileHash(b []byte) string {
+	return fmt.Sprintf("%x", mathsets.Hash256Twice(b))
+}
@@ -2,20 +2,46 @@ package webconfig
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// StatusBlockedIP is returned by ValidateHTTPRequest when the client
+// ip addr is listed in the blocked-ip file. It's outside the range of
+// the HTTP status codes, so that it's not mistaken for the code of a
+// conditional-http-service rule (i.e. 403); Middleware answers it with
+// 403 Forbidden.
+const StatusBlockedIP = 1000 + http.StatusForbidden
+
 // ValidateHTTPRequest validates client http reqest according to rules
 // defined within the Config structure. It returns true, 0; if request is
 // validated, and false, http-error-code; if request is not validated.
 // If the forward-paths section has values, the response will be forwarded
 // accordingly (if a match is found).
+// Clients listed in the blocked-ip file are rejected first with
+// StatusBlockedIP; see DropBlockedConnections. During the maintenance
+// window, 503 is returned (with the Retry-After header set) to all
+// requests that are not in the bypass list; see ServeMaintenancePage.
 func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bool, int) {
 
+	// All values are read from one snapshot; a reload in the
+	// meantime does not affect this request.
+	cfg := c.snapshot()
+
 	rPath := strings.ToLower(r.URL.Path)
+	ip := c.ClientIP(r)
+
+	// Blocked ip addr; these are checked before anything else.
+	if cfg.IsBlockedIP(ip) {
+		if cfg.DropBlockedConnections {
+			dropConnection(w)
+		}
+		return false, StatusBlockedIP
+	}
 
 	// Host name
-	if c.ValidateRemoteHost {
+	if cfg.ValidateRemoteHost {
 		rHost := strings.ToLower(strings.Split(r.Host, ":")[0])
 
 		// Do not exclude loadhost or loopback ip addr; as the remote host can be
@@ -23,12 +49,12 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 		// For example,
 		//    the following could go through with no problems, if not dealt with:
 		//    curl -X GET -H "Host:127.0.0.1" "https://your-good-domain-name.com/"
-		if c.Site.HostName != "" && rHost != c.Site.HostName /*&& rHost != "localhost" && rHost != "127.0.0.1"*/ {
+		if cfg.Site.HostName != "" && rHost != cfg.Site.HostName /*&& rHost != "localhost" && rHost != "127.0.0.1"*/ {
 
 			// Also check the alternate host names
 			ok := false
-			for i := 0; i < len(c.Site.AlternateHostNames); i++ {
-				if c.Site.AlternateHostNames[i] == rHost {
+			for i := 0; i < len(cfg.Site.AlternateHostNames); i++ {
+				if cfg.Site.AlternateHostNames[i] == rHost {
 					ok = true
 					break
 				}
@@ -40,11 +66,17 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 		}
 	}
 
+	// Maintenance window
+	if cfg.InMaintenance() && !cfg.maintenanceBypass(ip, rPath) {
+		w.Header().Set("Retry-After", strconv.Itoa(cfg.retryAfter(time.Now())))
+		return false, http.StatusServiceUnavailable
+	}
+
 	// Method allowed
 	failed := true
 	s := r.Method
-	for i := 0; i < len(c.HTTP.AllowedMethods); i++ {
-		if s == c.HTTP.AllowedMethods[i] {
+	for i := 0; i < len(cfg.HTTP.AllowedMethods); i++ {
+		if s == cfg.HTTP.AllowedMethods[i] {
 			failed = false
 			break
 		}
@@ -56,32 +88,24 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 	// This is the order of: restrict-paths, exclude-path, forward-paths, conditional-http-service
 
 	// restrict-paths
-	for i := 0; i < len(c.URLPaths.Restrict); i++ {
-		sl := strings.ToLower(c.URLPaths.Restrict[i])
-		// On-error  the err-text is placed instead of the
-		// expected value starting with: ~@error
-		if strings.HasPrefix(sl, "~@error") {
-			continue
-		}
+	for i := 0; i < len(cfg.URLPaths.Restrict); i++ {
+		sl := strings.ToLower(cfg.URLPaths.Restrict[i])
 		if sl == rPath {
 			return false, http.StatusUnauthorized
 		}
 	}
 
 	// exclude-path
-	for i := 0; i < len(c.URLPaths.Exclude); i++ {
-		sl := strings.ToLower(c.URLPaths.Exclude[i])
-		if strings.HasPrefix(sl, "~@error") {
-			continue
-		}
+	for i := 0; i < len(cfg.URLPaths.Exclude); i++ {
+		sl := strings.ToLower(cfg.URLPaths.Exclude[i])
 		if sl == rPath {
 			return false, http.StatusNotFound
 		}
 	}
 
 	// forward-paths
-	for i := 0; i < len(c.URLPaths.Forward); i++ {
-		sl := strings.ToLower(c.URLPaths.Forward[i])
+	for i := 0; i < len(cfg.URLPaths.Forward); i++ {
+		sl := strings.ToLower(cfg.URLPaths.Forward[i])
 		v := strings.Split(sl, "|")
 		left := ""
 		right := ""
@@ -89,7 +113,8 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 			left = v[0]
 			right = v[1]
 		}
-		if right == "" || strings.HasPrefix(right, "~@error") {
+		// invalid values are left out when the config is read; see Diagnostics.
+		if right == "" {
 			continue
 		}
 		if left == rPath {
@@ -99,16 +124,15 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 	}
 
 	// conditional-http-service
-	ip := strings.Split(strings.Replace(strings.Replace(r.RemoteAddr, "[", "", -1), "]", "", -1), ":")[0]
 	qs := r.URL.RawQuery
 
-	for i := 0; i < len(c.URLPaths.ServeOnlyTo); i++ {
-		if rPath == c.URLPaths.ServeOnlyTo[i].URLPath {
+	for i := 0; i < len(cfg.URLPaths.ServeOnlyTo); i++ {
+		if rPath == cfg.URLPaths.ServeOnlyTo[i].URLPath {
 			// check headers
-			if c.URLPaths.ServeOnlyTo[i].RuleType == CondHTTPSvc_Header {
+			if cfg.URLPaths.ServeOnlyTo[i].RuleType == CondHTTPSvc_Header {
 				for _, v := range r.Header {
-					for j := 0; j < len(c.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria); j++ {
-						m := c.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria[j]
+					for j := 0; j < len(cfg.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria); j++ {
+						m := cfg.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria[j]
 						for k := 0; k < len(v); k++ {
 							if strings.Contains(v[k], m) {
 								// The caller can view the page - as its request header
@@ -121,8 +145,8 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 			}
 
 			// check IP address and query string
-			for j := 0; j < len(c.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria); j++ {
-				if c.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria[j] == ip || strings.Contains(qs, c.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria[j]) {
+			for j := 0; j < len(cfg.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria); j++ {
+				if cfg.URLPaths.ServeOnlyTo[i].ipMatcher.Contains(ip) || strings.Contains(qs, cfg.URLPaths.ServeOnlyTo[i].ServeOnlyToCriteria[j]) {
 					// The caller can view the page - as its request header
 					// has a value that matches the ServerOnlyTo critiera
 					return true, 0
@@ -133,7 +157,7 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 			//   1. there is a rule for the current r.Path
 			//   2. there is no match found to allow the client to recieve the content
 			// so, return error
-			errCode := c.URLPaths.ServeOnlyTo[i].HTTPStatusCode
+			errCode := cfg.URLPaths.ServeOnlyTo[i].HTTPStatusCode
 
 			if errCode < 1 {
 				errCode = 404 // default error code
@@ -145,3 +169,36 @@ func (c *Config) ValidateHTTPRequest(w http.ResponseWriter, r *http.Request) (bo
 
 	return true, 0
 }
+
+// IsBlockedIP tells if ip is covered by an entry in the blocked-ip file.
+func (c *Config) IsBlockedIP(ip string) bool {
+	return c.snapshot().blockedIP.Contains(ip)
+}
+
+// IsAdminIP tells if ip is allowed to access the admin website. If
+// allowed-ip-addr has no (valid) entries, only the local machine
+// is allowed.
+func (c *Config) IsAdminIP(ip string) bool {
+	c = c.snapshot()
+	if c.adminIP.Len() == 0 {
+		a, err := parseAddr(ip)
+		return err == nil && a.IsLoopback()
+	}
+	return c.adminIP.Contains(ip)
+}
+
+// dropConnection hijacks the underlying connection and closes it
+// without writing a response. If the ResponseWriter does not support
+// hijacking nothing is written either; the caller should not write
+// to w after this.
+func dropConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,114 @@
+package webconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestConfig creates a Config with the default config file in a
+// new web root; it's closed when the test ends.
+func newTestConfig(t *testing.T, opts ...Option) *Config {
+	t.Helper()
+	c, err := NewWebConfigE(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestValidateHTTPRequestBlockedIP(t *testing.T) {
+	c := newTestConfig(t)
+	path := c.AppDataPath + "/.cfg/" + blockedIPFileName
+	if err := os.WriteFile(path, []byte("10.1.2.0/24 spam\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rule := `[{"rule-type":"ip-address","url-path":"/admin","serve-only-to-criteria":["127.0.0.1"],"http-status-code":403}]`
+	if err := c.Set("URLPaths", "conditional-http-service", rule); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		path       string
+		code       int
+	}{
+		{"10.1.2.3:1234", "/", StatusBlockedIP},
+		{"10.1.2.3:1234", "/admin", StatusBlockedIP},
+		{"10.9.9.9:1234", "/admin", http.StatusForbidden},
+		{"127.0.0.1:1234", "/admin", 0},
+		{"10.9.9.9:1234", "/", 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		r.RemoteAddr = tt.remoteAddr
+		_, code := c.ValidateHTTPRequest(httptest.NewRecorder(), r)
+		if code != tt.code {
+			t.Errorf("%s %s: got %d; want %d", tt.remoteAddr, tt.path, code, tt.code)
+		}
+	}
+}
+
+func TestConditionalHTTPServiceCriteria(t *testing.T) {
+	c := newTestConfig(t)
+	rule := `[{"rule-type":"ip-address","url-path":"/x","serve-only-to-criteria":["*","10.0.0.0/8","Googlebot"],"http-status-code":404}]`
+	if err := c.Set("URLPaths", "conditional-http-service", rule); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		query      string
+		code       int
+	}{
+		{"10.1.2.3:1234", "", 0},
+		{"192.168.1.1:1234", "", http.StatusNotFound},
+		{"192.168.1.1:1234", "q=*", 0},
+		{"192.168.1.1:1234", "ua=Googlebot", 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/x?"+tt.query, nil)
+		r.RemoteAddr = tt.remoteAddr
+		_, code := c.ValidateHTTPRequest(httptest.NewRecorder(), r)
+		if code != tt.code {
+			t.Errorf("%s ?%s: got %d; want %d", tt.remoteAddr, tt.query, code, tt.code)
+		}
+	}
+
+	warnings := 0
+	for _, d := range c.Diagnostics() {
+		if d.Key == "conditional-http-service" && d.Severity == SeverityWarning {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("got %d warnings; want 2 (* and Googlebot)", warnings)
+	}
+}
+
+// TestValidateRemoteHostRefresh sets the option after start-up; it's
+// read from the snapshot, so it applies after the next Refresh.
+func TestValidateRemoteHostRefresh(t *testing.T) {
+	c := newTestConfig(t, WithPolling(), WithPollInterval(time.Hour))
+	if err := c.Set("Site", "hostname", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	validate := func() int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = "attacker.example"
+		_, code := c.ValidateHTTPRequest(httptest.NewRecorder(), r)
+		return code
+	}
+	if code := validate(); code != 0 {
+		t.Fatalf("got %d before the option is set; want 0", code)
+	}
+	c.ValidateRemoteHost = true
+	c.Refresh()
+	if code := validate(); code != http.StatusBadGateway {
+		t.Errorf("got %d; want %d", code, http.StatusBadGateway)
+	}
+}
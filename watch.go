@@ -0,0 +1,87 @@
+package webconfig
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// defaultPollInterval is used when the config files are polled
+	// for changes; see SetPollInterval.
+	defaultPollInterval = 15 * time.Second
+
+	// watchDebounce is the quiet period after the last file event
+	// before the config is reloaded; editors and atomic replaces
+	// generate several events for one save.
+	watchDebounce = 150 * time.Millisecond
+)
+
+// errWatchUnsupported is returned by watchFiles on platforms
+// without file-system notifications.
+var errWatchUnsupported = errors.New("file-system notifications are not supported on this platform")
+
+// SetPollInterval sets how often the config files are checked for
+// changes when polling is used; that is when file-system
+// notifications are not available. The default is 15 seconds.
+func (c *Config) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		d = defaultPollInterval
+	}
+	c.root().state().pollInterval.Store(int64(d))
+}
+
+// pollInterval returns the interval set by SetPollInterval.
+func (c *Config) pollInterval() time.Duration {
+	d := time.Duration(c.root().state().pollInterval.Load())
+	if d <= 0 {
+		return defaultPollInterval
+	}
+	return d
+}
+
+// refreshConfig reads the config values from the appdata/.cfg file
+// so that the website [service] does not have to be restarted if
+// a value changes. The .cfg directory is watched for changes; if
+// that is not possible (or the watch is lost) the files are polled.
+func (c *Config) refreshConfig(stop <-chan struct{}) {
+	err := c.watchFiles(stop)
+	if err == nil {
+		// stopped
+		return
+	}
+	log.Printf("webconfig: watching %s: %v; polling every %s", filepath.Dir(c.ConfigFilePath), err, c.pollInterval())
+
+	c.pollConfig(stop)
+}
+
+// pollConfig reads the config every poll-interval until stop
+// is closed.
+func (c *Config) pollConfig(stop <-chan struct{}) {
+	for {
+		t := time.NewTimer(c.pollInterval())
+		select {
+		case <-stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		c.reload()
+	}
+}
+
+// isWatchedFile tells if a change to the file path should reload
+// the config; the config and blocked-ip files, the included files,
+// the drop-in directory and the maintenance page.
+func (c *Config) isWatchedFile(path string) bool {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(filepath.Clean(c.ConfigFilePath))
+	switch path {
+	case filepath.Clean(c.ConfigFilePath), filepath.Join(dir, blockedIPFileName), filepath.Clean(c.confDirPath()),
+		filepath.Clean(c.maintPagePath()):
+		return true
+	}
+	return c.isIncluded(path)
+}
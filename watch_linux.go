@@ -0,0 +1,171 @@
+//go:build linux
+
+package webconfig
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchMask covers in-place writes, atomic replaces (rename of a
+// temp file over the original) and deletes.
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+	syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+var errWatchLost = errors.New("the watched directory was removed or moved")
+
+// inotifyEvent is an event read by readInotify; lost is set when
+// the watch was removed (i.e. the directory was deleted).
+type inotifyEvent struct {
+	wd   int
+	name string
+	lost bool
+}
+
+// watchFiles reloads the config on inotify events of the .cfg
+// directory and the directories of the included files; the events
+// are debounced. It returns nil when stop is closed; or an error if
+// the .cfg directory cannot be watched.
+func (c *Config) watchFiles(stop <-chan struct{}) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+
+	// A non-blocking fd is handled by the runtime poller, so
+	// closing f unblocks the pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	defer f.Close()
+
+	cfgDir := filepath.Dir(c.ConfigFilePath)
+	cfgWd, err := syscall.InotifyAddWatch(fd, cfgDir, watchMask)
+	if err != nil {
+		return err
+	}
+	dirs := map[int]string{cfgWd: cfgDir}
+
+	// Pick up changes made before the watch was in place.
+	c.reload()
+	c.syncWatches(fd, dirs)
+
+	events := make(chan inotifyEvent)
+	errc := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+
+	go readInotify(f, events, errc, quit)
+
+	var fire <-chan time.Time
+	t := time.NewTimer(watchDebounce)
+	t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+
+		case err := <-errc:
+			return err
+
+		case ev := <-events:
+			if ev.lost {
+				if ev.wd == cfgWd {
+					return errWatchLost
+				}
+				delete(dirs, ev.wd)
+			} else if dir, ok := dirs[ev.wd]; ok && ev.name != "" && !c.isWatchedFile(filepath.Join(dir, ev.name)) {
+				// a blank name means events were dropped.
+				continue
+			}
+			t.Stop()
+			t = time.NewTimer(watchDebounce)
+			fire = t.C
+
+		case <-fire:
+			fire = nil
+			c.reload()
+			c.syncWatches(fd, dirs)
+		}
+	}
+}
+
+// syncWatches watches the directories of the included files (and
+// the drop-in directory) and of the maintenance page, and removes the
+// watches that are no longer needed; the .cfg directory is always
+// watched. dirs holds the watched directories by watch descriptor.
+func (c *Config) syncWatches(fd int, dirs map[int]string) {
+	cfgDir := filepath.Dir(c.ConfigFilePath)
+
+	want := make(map[string]bool)
+	list := append(c.includeDirs(), filepath.Dir(c.maintPagePath()))
+	for i := 0; i < len(list); i++ {
+		want[list[i]] = true
+	}
+
+	have := make(map[string]bool)
+	for wd, dir := range dirs {
+		if dir != cfgDir && !want[dir] {
+			syscall.InotifyRmWatch(fd, uint32(wd))
+			delete(dirs, wd)
+			continue
+		}
+		have[dir] = true
+	}
+	for i := 0; i < len(list); i++ {
+		if have[list[i]] {
+			continue
+		}
+		// The directory may not exist (yet); its parent is not
+		// watched, so it's picked up on the next reload.
+		if wd, err := syscall.InotifyAddWatch(fd, list[i], watchMask); err == nil {
+			dirs[wd] = list[i]
+		}
+	}
+}
+
+// readInotify sends the events read from f to events until f is
+// closed or quit is closed.
+func readInotify(f *os.File, events chan<- inotifyEvent, errc chan<- error, quit <-chan struct{}) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			off += syscall.SizeofInotifyEvent
+
+			ev := inotifyEvent{wd: wd}
+			if nameLen > 0 && off+nameLen <= n {
+				ev.name = strings.TrimRight(string(buf[off:off+nameLen]), "\x00")
+			}
+			off += nameLen
+
+			if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0 {
+				ev.lost = true
+			}
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				// events were dropped; reload anyway.
+				ev.name = ""
+			}
+
+			select {
+			case events <- ev:
+			case <-quit:
+				return
+			}
+		}
+	}
+}
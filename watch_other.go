@@ -0,0 +1,9 @@
+//go:build !linux
+
+package webconfig
+
+// watchFiles is not available on this platform; the config
+// files are polled.
+func (c *Config) watchFiles(stop <-chan struct{}) error {
+	return errWatchUnsupported
+}